@@ -0,0 +1,375 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+type subPropCreater func(map[string]interface{}, *schemaProperty) (schemaPropertySub, error)
+
+// dialect represents the keywords of a version of JSON Schema.
+type dialect struct {
+	schemaType SchemaType
+
+	// creaters are constructors of the keywords other than the ones set by schemaProperty.Recognize.
+	creaters []subPropCreater
+	// lateCreaters are constructors of the keywords which are evaluated after all the other keywords,
+	// because they depend on the annotations of them. (e.g. unevaluatedProperties)
+	lateCreaters []subPropCreater
+
+	// idKeyword is the keyword which identifies a schema. ("id" or "$id")
+	idKeyword string
+	// anchorKeywords are the keywords which define plain name fragments. (since 2019-09)
+	anchorKeywords []string
+	// booleanSchema reports whether true and false are allowed as schemas.
+	booleanSchema bool
+	// refApplicator reports whether "$ref" is applied with its sibling keywords, instead of replacing them.
+	refApplicator bool
+	// prefixItems reports whether the tuple is "prefixItems", and "items" applies to the rest of the items.
+	prefixItems bool
+}
+
+var dialect_Draft3 = &dialect{
+	schemaType: SchemaType_Draft3,
+	creaters: []subPropCreater{
+		newSubProp_type3,
+		newSubProp_disallow,
+		newSubProp_maximum,
+		newSubProp_minimum,
+		newSubProp_maxLength,
+		newSubProp_minLength,
+		newSubProp_maxItems,
+		newSubProp_minItems,
+		newSubProp_pattern,
+		newSubProp_uniqueItem,
+		newSubProp_required3,
+		newSubProp_dependency,
+		newSubProp_enum,
+		newSubProp_extends,
+		newSubProp_divisibleBy,
+		newSubProp_format,
+		newSubProp_custom,
+	},
+	idKeyword: "id",
+}
+
+var dialect_Draft4 = &dialect{
+	schemaType: SchemaType_Draft4,
+	creaters: []subPropCreater{
+		newSubProp_maxProperties,
+		newSubProp_minProperties,
+		newSubProp_maximum,
+		newSubProp_minimum,
+		newSubProp_maxLength,
+		newSubProp_minLength,
+		newSubProp_maxItems,
+		newSubProp_minItems,
+		newSubProp_pattern,
+		newSubProp_uniqueItem,
+		newSubProp_required,
+		newSubProp_dependency,
+		newSubProp_enum,
+		newSubProp_allOf,
+		newSubProp_anyOf,
+		newSubProp_oneOf,
+		newSubProp_not,
+		newSubProp_multipleOf,
+		newSubProp_format,
+		newSubProp_custom,
+	},
+	idKeyword: "id",
+}
+
+var dialect_Draft6 = &dialect{
+	schemaType: SchemaType_Draft6,
+	creaters: []subPropCreater{
+		newSubProp_maxProperties,
+		newSubProp_minProperties,
+		newSubProp_maximum6,
+		newSubProp_exclusiveMaximum6,
+		newSubProp_minimum6,
+		newSubProp_exclusiveMinimum6,
+		newSubProp_maxLength,
+		newSubProp_minLength,
+		newSubProp_maxItems,
+		newSubProp_minItems,
+		newSubProp_pattern,
+		newSubProp_uniqueItem,
+		newSubProp_contains,
+		newSubProp_required,
+		newSubProp_dependency,
+		newSubProp_propertyNames,
+		newSubProp_enum,
+		newSubProp_const,
+		newSubProp_allOf,
+		newSubProp_anyOf,
+		newSubProp_oneOf,
+		newSubProp_not,
+		newSubProp_multipleOf,
+		newSubProp_format,
+		newSubProp_custom,
+	},
+	idKeyword:     "$id",
+	booleanSchema: true,
+}
+
+var dialect_Draft7 = &dialect{
+	schemaType: SchemaType_Draft7,
+	creaters: []subPropCreater{
+		newSubProp_maxProperties,
+		newSubProp_minProperties,
+		newSubProp_maximum6,
+		newSubProp_exclusiveMaximum6,
+		newSubProp_minimum6,
+		newSubProp_exclusiveMinimum6,
+		newSubProp_maxLength,
+		newSubProp_minLength,
+		newSubProp_maxItems,
+		newSubProp_minItems,
+		newSubProp_pattern,
+		newSubProp_uniqueItem,
+		newSubProp_contains,
+		newSubProp_required,
+		newSubProp_dependency,
+		newSubProp_propertyNames,
+		newSubProp_enum,
+		newSubProp_const,
+		newSubProp_if,
+		newSubProp_allOf,
+		newSubProp_anyOf,
+		newSubProp_oneOf,
+		newSubProp_not,
+		newSubProp_multipleOf,
+		newSubProp_format,
+		newSubProp_custom,
+	},
+	idKeyword:     "$id",
+	booleanSchema: true,
+}
+
+var dialect_Draft2019_09 = &dialect{
+	schemaType: SchemaType_Draft2019_09,
+	creaters: []subPropCreater{
+		newSubProp_ref,
+		newSubProp_recursiveRef,
+		newSubProp_maxProperties,
+		newSubProp_minProperties,
+		newSubProp_maximum6,
+		newSubProp_exclusiveMaximum6,
+		newSubProp_minimum6,
+		newSubProp_exclusiveMinimum6,
+		newSubProp_maxLength,
+		newSubProp_minLength,
+		newSubProp_maxItems,
+		newSubProp_minItems,
+		newSubProp_pattern,
+		newSubProp_uniqueItem,
+		newSubProp_contains2019,
+		newSubProp_required,
+		newSubProp_dependentRequired,
+		newSubProp_dependentSchemas,
+		newSubProp_propertyNames,
+		newSubProp_enum,
+		newSubProp_const,
+		newSubProp_if,
+		newSubProp_allOf,
+		newSubProp_anyOf,
+		newSubProp_oneOf,
+		newSubProp_not,
+		newSubProp_multipleOf,
+		newSubProp_format,
+		newSubProp_custom,
+	},
+	lateCreaters: []subPropCreater{
+		newSubProp_unevaluatedItems,
+		newSubProp_unevaluatedProperties,
+	},
+	idKeyword:      "$id",
+	anchorKeywords: []string{"$anchor"},
+	booleanSchema:  true,
+	refApplicator:  true,
+}
+
+var dialect_Draft2020_12 = &dialect{
+	schemaType: SchemaType_Draft2020_12,
+	creaters: []subPropCreater{
+		newSubProp_ref,
+		newSubProp_dynamicRef,
+		newSubProp_maxProperties,
+		newSubProp_minProperties,
+		newSubProp_maximum6,
+		newSubProp_exclusiveMaximum6,
+		newSubProp_minimum6,
+		newSubProp_exclusiveMinimum6,
+		newSubProp_maxLength,
+		newSubProp_minLength,
+		newSubProp_maxItems,
+		newSubProp_minItems,
+		newSubProp_pattern,
+		newSubProp_uniqueItem,
+		newSubProp_contains2020,
+		newSubProp_required,
+		newSubProp_dependentRequired,
+		newSubProp_dependentSchemas,
+		newSubProp_propertyNames,
+		newSubProp_enum,
+		newSubProp_const,
+		newSubProp_if,
+		newSubProp_allOf,
+		newSubProp_anyOf,
+		newSubProp_oneOf,
+		newSubProp_not,
+		newSubProp_multipleOf,
+		newSubProp_format,
+		newSubProp_custom,
+	},
+	lateCreaters: []subPropCreater{
+		newSubProp_unevaluatedItems,
+		newSubProp_unevaluatedProperties,
+	},
+	idKeyword:      "$id",
+	anchorKeywords: []string{"$anchor", "$dynamicAnchor"},
+	booleanSchema:  true,
+	refApplicator:  true,
+	prefixItems:    true,
+}
+
+// dialects maps the URIs of "$schema" to the dialects.
+// It is built by init, because the creaters refer to it through findDialect.
+var dialects map[SchemaType]*dialect
+
+func init() {
+	dialects = map[SchemaType]*dialect{
+		SchemaType_Draft3:       dialect_Draft3,
+		SchemaType_Draft4:       dialect_Draft4,
+		SchemaType_Draft6:       dialect_Draft6,
+		SchemaType_Draft7:       dialect_Draft7,
+		SchemaType_Draft2019_09: dialect_Draft2019_09,
+		SchemaType_Draft2020_12: dialect_Draft2020_12,
+		// the latest version when this package was written.
+		SchemaType_Standard: dialect_Draft4,
+	}
+}
+
+// metaSchemas holds the custom meta-schemas registered to all validators.
+var metaSchemas = struct {
+	sync.RWMutex
+	schemas map[string]map[string]interface{}
+}{
+	schemas: make(map[string]map[string]interface{}),
+}
+
+// RegisterMetaSchema registers the custom meta-schema of the URI to all validators.
+// Schemas which declare the URI by "$schema" are compiled with the dialect declared by "$schema" of the meta-schema.
+func RegisterMetaSchema(uri string, metaSchema []byte) error {
+	obj, err := parseMetaSchema(metaSchema)
+	if err != nil {
+		return err
+	}
+
+	metaSchemas.Lock()
+	defer metaSchemas.Unlock()
+
+	metaSchemas.schemas[normalizeSchemaURI(uri)] = obj
+	return nil
+}
+
+func parseMetaSchema(metaSchema []byte) (map[string]interface{}, error) {
+	var obj map[string]interface{}
+	err := json.Unmarshal(metaSchema, &obj)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// getMetaSchema returns the custom meta-schema in the validator or the registry.
+func getMetaSchema(uri string, v *Validator) (map[string]interface{}, bool, error) {
+	uri = normalizeSchemaURI(uri)
+	if buf, ok := v.metaSchemas[uri]; ok {
+		obj, err := parseMetaSchema(buf)
+		return obj, err == nil, err
+	}
+
+	metaSchemas.RLock()
+	defer metaSchemas.RUnlock()
+
+	obj, ok := metaSchemas.schemas[uri]
+	return obj, ok, nil
+}
+
+// normalizeSchemaURI removes the empty fragment, which is optional in "$schema".
+func normalizeSchemaURI(uri string) string {
+	return strings.TrimSuffix(uri, "#")
+}
+
+// findDialect returns the dialect of the URI declared by "$schema".
+// A custom meta-schema follows "$schema" of itself until a known dialect is found.
+func findDialect(uri string, v *Validator) (*dialect, error) {
+	seen := make(map[string]bool)
+	for {
+		if d, ok := dialects[GetSchemaType(uri)]; ok {
+			return d, nil
+		}
+
+		if seen[normalizeSchemaURI(uri)] {
+			// meta-schemas refer to each other.
+			return nil, ErrInvalidSchemaVersion
+		}
+		seen[normalizeSchemaURI(uri)] = true
+
+		meta, ok, err := getMetaSchema(uri, v)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrInvalidSchemaVersion
+		}
+
+		uri, ok = meta["$schema"].(string)
+		if !ok {
+			return nil, ErrInvalidSchemaVersion
+		}
+	}
+}
+
+// resourceDialect returns the dialect declared by "$schema" of the schema, if it is the root of an embedded schema resource.
+// Otherwise it returns d, as "$schema" is ignored in the other subschemas. (the same rule as schemaProperty.SetDialect)
+func resourceDialect(schema map[string]interface{}, d *dialect, v *Validator) *dialect {
+	uri, ok := schema["$schema"].(string)
+	if !ok {
+		return d
+	}
+
+	dd, err := findDialect(uri, v)
+	if err != nil {
+		return d
+	}
+
+	if id, ok := schema[dd.idKeyword].(string); ok && !strings.HasPrefix(id, "#") {
+		return dd
+	}
+	return d
+}
+
+// getDialect returns the dialect declared by "$schema" of the root schema. (the default dialect of the validator if not declared)
+// A boolean root schema is in the default dialect, which rejects it before draft6.
+func getDialect(schema interface{}, v *Validator) (*dialect, error) {
+	obj, _ := schema.(map[string]interface{})
+	raw, ok := obj["$schema"]
+	if !ok {
+		return v.dialect, nil
+	}
+
+	uri, ok := raw.(string)
+	if !ok {
+		return nil, newSchemaError("#/$schema", "$schema", raw, ErrInvalidSchemaVersion, "must be a string, but got %s", getJsonTypeOf(raw))
+	}
+
+	d, err := findDialect(uri, v)
+	if err != nil {
+		return nil, newSchemaError("#/$schema", "$schema", raw, err, "unknown dialect %q", uri)
+	}
+	return d, nil
+}
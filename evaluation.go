@@ -0,0 +1,361 @@
+package jsonschema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError represents a failure of a keyword against a part of the document.
+type ValidationError struct {
+	// InstanceLocation is a JSON pointer to the failed value in the document.
+	InstanceLocation string
+	// KeywordLocation is a JSON pointer to the failed keyword in the schema. (e.g. "#/properties/age/minimum")
+	KeywordLocation string
+	// Keyword is the name of the failed keyword. (empty for the false schema)
+	Keyword string
+	// Message is a human-readable description of the failure.
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("jsonschema: %s at '%s' (%s)", e.Message, e.InstanceLocation, e.KeywordLocation)
+}
+
+// ValidationErrors represents all failures found by an exhaustive validation.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, v := range e {
+		msgs = append(msgs, v.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// InvalidSchemaError represents violations of a schema against the meta-schema of its dialect.
+// It matches ErrInvalidSchemaFormat, and each violation and its sentinel error with errors.Is and errors.As.
+type InvalidSchemaError struct {
+	// Errors holds the violations, whose Pointer points to the invalid part of the schema.
+	Errors []*SchemaError
+}
+
+func (e *InvalidSchemaError) Error() string {
+	msgs := make([]string, 0, len(e.Errors)+1)
+	msgs = append(msgs, "jsonschema: invalid schema against the meta-schema")
+	for _, v := range e.Errors {
+		msgs = append(msgs, v.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *InvalidSchemaError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors)+1)
+	errs = append(errs, ErrInvalidSchemaFormat)
+	for _, v := range e.Errors {
+		errs = append(errs, v)
+	}
+	return errs
+}
+
+// evalContext holds the state of a validation.
+// A context is created for each validation, so that compiled schemas are never modified while validating.
+type evalContext struct {
+	errors     []*ValidationError
+	exhaustive bool
+	maxErrors  int
+
+	// aborted holds the error which stopped the validation. It is shared with the branches.
+	aborted *error
+
+	scope *evalScope
+
+	// dynamicScope holds the schema resources under evaluation, from the outermost one.
+	dynamicScope []*schemaResource
+	// ref is the innermost reference under evaluation. (nil if not under any reference)
+	ref *evalRef
+	// active holds the referred schemas under evaluation with their instances, to stop references which never advance in the document.
+	// It is shared with the branches.
+	active map[evalFrame]bool
+
+	// unit is the output unit of the schema under evaluation. (nil if results are not recorded)
+	unit *OutputUnit
+}
+
+// evalFrame represents a referred schema under evaluation with its instance.
+// A string instance is held by value, since propertyNames evaluates the names at the pointer of their object.
+type evalFrame struct {
+	target *schemaProperty
+	ptr    string
+	value  interface{}
+}
+
+// evalRef represents a reference under evaluation.
+// The keywords of the referred schema are located under the reference, instead of where they are compiled.
+type evalRef struct {
+	prev *evalRef
+	// location is the keyword location of the reference, and root is where the referred schema is compiled.
+	location string
+	root     string
+	frame    evalFrame
+}
+
+// evalScope holds the state of a schema under evaluation.
+type evalScope struct {
+	prev       *evalScope
+	parentUnit *OutputUnit
+	ptr        string
+
+	// evaluated holds names of properties which are evaluated by properties and patternProperties.
+	evaluated map[string]bool
+
+	// properties and items hold the annotations for unevaluatedProperties and unevaluatedItems.
+	// They include the ones of succeeded subschemas which are applied to the same instance. (e.g. allOf)
+	properties map[string]bool
+	items      map[int]bool
+}
+
+func newEvalScope(prev *evalScope, parentUnit *OutputUnit, ptr string) *evalScope {
+	return &evalScope{
+		prev:       prev,
+		parentUnit: parentUnit,
+		ptr:        ptr,
+		evaluated:  make(map[string]bool),
+		properties: make(map[string]bool),
+		items:      make(map[int]bool),
+	}
+}
+
+// merge adds the annotations of the scope to dst.
+func (s *evalScope) merge(dst *evalScope) {
+	for k := range s.properties {
+		dst.properties[k] = true
+	}
+	for i := range s.items {
+		dst.items[i] = true
+	}
+}
+
+func newEvalContext(exhaustive bool, maxErrors int) *evalContext {
+	return &evalContext{
+		errors:     make([]*ValidationError, 0),
+		exhaustive: exhaustive,
+		maxErrors:  maxErrors,
+		aborted:    new(error),
+		active:     make(map[evalFrame]bool),
+	}
+}
+
+// Record makes the context record the results of every evaluated schema for the output formats.
+// The returned unit holds the result of the root schema as its child.
+func (c *evalContext) Record() *OutputUnit {
+	c.unit = &OutputUnit{}
+	return c.unit
+}
+
+// NewBranch returns a context for subschemas whose failures may not be reported. (e.g. anyOf, not)
+// Annotations of the branch are not reported either, unless it is passed to MergeBranch.
+// The branch stops at the first failure, unless the results are recorded for the output formats.
+func (c *evalContext) NewBranch() *evalContext {
+	b := newEvalContext(false, 0)
+	b.aborted = c.aborted
+	b.active = c.active
+	if c.unit != nil {
+		b.exhaustive = c.exhaustive
+		b.unit = &OutputUnit{}
+	}
+	if c.scope != nil {
+		b.scope = newEvalScope(nil, nil, c.scope.ptr)
+	}
+	b.dynamicScope = append([]*schemaResource(nil), c.dynamicScope...)
+	b.ref = c.ref
+	return b
+}
+
+// MergeBranch reports the annotations of the succeeded branch to the schema under evaluation.
+func (c *evalContext) MergeBranch(branch *evalContext) {
+	if c.scope != nil && branch.scope != nil {
+		branch.scope.merge(c.scope)
+	}
+}
+
+// EnterSchema starts the evaluation of a schema. It must be followed by LeaveSchema.
+func (c *evalContext) EnterSchema(location, ptr string) {
+	c.scope = newEvalScope(c.scope, c.unit, ptr)
+
+	if c.unit != nil {
+		c.unit = &OutputUnit{KeywordLocation: c.KeywordLocation(location), InstanceLocation: ptr}
+		c.scope.parentUnit.children = append(c.scope.parentUnit.children, c.unit)
+	}
+}
+
+func (c *evalContext) LeaveSchema(valid bool) {
+	if c.unit != nil {
+		c.unit.Valid = valid
+		c.unit = c.scope.parentUnit
+	}
+
+	// annotations of a failed schema are dropped.
+	if prev := c.scope.prev; valid && prev != nil && prev.ptr == c.scope.ptr {
+		c.scope.merge(prev)
+	}
+	c.scope = c.scope.prev
+}
+
+// EnterRef starts the evaluation of the schema referred by the reference at location. It must be followed by LeaveRef if it succeeds.
+// It stops the validation with ErrInfiniteRecursion if the schema is already under evaluation with the same instance.
+func (c *evalContext) EnterRef(location string, target *schemaProperty, src interface{}, ptr string) bool {
+	frame := evalFrame{target: target, ptr: ptr}
+	if str, ok := src.(string); ok {
+		frame.value = str
+	}
+	if c.active[frame] {
+		c.Abort(fmt.Errorf("%w at '%s' (%s)", ErrInfiniteRecursion, ptr, c.KeywordLocation(location)))
+		return false
+	}
+
+	c.active[frame] = true
+	c.ref = &evalRef{prev: c.ref, location: c.KeywordLocation(location), root: target.location, frame: frame}
+	return true
+}
+
+func (c *evalContext) LeaveRef() {
+	delete(c.active, c.ref.frame)
+	c.ref = c.ref.prev
+}
+
+// KeywordLocation returns the location of the keyword through the references under evaluation. (e.g. "#/properties/a/$ref/minimum")
+func (c *evalContext) KeywordLocation(location string) string {
+	if c.ref == nil {
+		return location
+	}
+	return c.ref.location + strings.TrimPrefix(location, c.ref.root)
+}
+
+// EnterResource adds the schema resource to the dynamic scope. It must be followed by LeaveResource.
+func (c *evalContext) EnterResource(r *schemaResource) {
+	c.dynamicScope = append(c.dynamicScope, r)
+}
+
+func (c *evalContext) LeaveResource() {
+	c.dynamicScope = c.dynamicScope[:len(c.dynamicScope)-1]
+}
+
+// MarkEvaluated records that the property is evaluated by the schema under evaluation.
+func (c *evalContext) MarkEvaluated(name string) {
+	c.scope.evaluated[name] = true
+	c.scope.properties[name] = true
+}
+
+// IsEvaluated reports whether the property is evaluated by the schema under evaluation.
+func (c *evalContext) IsEvaluated(name string) bool {
+	return c.scope.evaluated[name]
+}
+
+// AnnotateProperty records that the property is evaluated by the schema or its subschemas.
+func (c *evalContext) AnnotateProperty(name string) {
+	c.scope.properties[name] = true
+}
+
+// IsPropertyAnnotated reports whether the property is evaluated by the schema or its subschemas.
+func (c *evalContext) IsPropertyAnnotated(name string) bool {
+	return c.scope.properties[name]
+}
+
+// AnnotateItem records that the item is evaluated by the schema or its subschemas.
+func (c *evalContext) AnnotateItem(index int) {
+	c.scope.items[index] = true
+}
+
+// IsItemAnnotated reports whether the item is evaluated by the schema or its subschemas.
+func (c *evalContext) IsItemAnnotated(index int) bool {
+	return c.scope.items[index]
+}
+
+func (c *evalContext) AddError(ptr, location, keyword, format string, args ...interface{}) {
+	c.AddBranchError(nil, ptr, location, keyword, format, args...)
+}
+
+// AddBranchError reports a failure of the keyword which evaluated subschemas in branches.
+func (c *evalContext) AddBranchError(branches []*evalContext, ptr, location, keyword, format string, args ...interface{}) {
+	if c.maxErrors > 0 && len(c.errors) >= c.maxErrors {
+		return
+	}
+
+	location = c.KeywordLocation(location)
+	err := &ValidationError{
+		InstanceLocation: ptr,
+		KeywordLocation:  location,
+		Keyword:          keyword,
+		Message:          fmt.Sprintf(format, args...),
+	}
+	c.errors = append(c.errors, err)
+
+	if c.unit != nil {
+		c.unit.children = append(c.unit.children, &OutputUnit{
+			Valid:            false,
+			KeywordLocation:  location,
+			InstanceLocation: ptr,
+			Error:            err.Message,
+			children:         branchUnits(branches),
+		})
+	}
+}
+
+// AddBranchResult records subschemas in branches which are evaluated by a succeeded keyword.
+func (c *evalContext) AddBranchResult(branches []*evalContext, ptr, location string) {
+	if c.unit != nil {
+		c.unit.children = append(c.unit.children, &OutputUnit{
+			Valid:            true,
+			KeywordLocation:  c.KeywordLocation(location),
+			InstanceLocation: ptr,
+			children:         branchUnits(branches),
+		})
+	}
+}
+
+func branchUnits(branches []*evalContext) []*OutputUnit {
+	units := make([]*OutputUnit, 0)
+	for _, b := range branches {
+		if b.unit != nil {
+			units = append(units, b.unit.children...)
+		}
+	}
+	return units
+}
+
+// Abort stops the validation by the error, which is not a failure of the document. (e.g. ErrRegexpTimeout)
+func (c *evalContext) Abort(err error) {
+	if *c.aborted == nil {
+		*c.aborted = err
+	}
+}
+
+// Aborted returns the error which stopped the validation, or nil.
+func (c *evalContext) Aborted() error {
+	return *c.aborted
+}
+
+// ShouldContinue reports whether the validation goes on after a failure.
+func (c *evalContext) ShouldContinue() bool {
+	if c.Aborted() != nil {
+		return false
+	}
+	if !c.exhaustive {
+		return false
+	}
+	return c.maxErrors <= 0 || len(c.errors) < c.maxErrors
+}
+
+func (c *evalContext) Err() error {
+	if err := c.Aborted(); err != nil {
+		return err
+	}
+	if len(c.errors) == 0 {
+		return nil
+	}
+
+	if c.exhaustive {
+		return ValidationErrors(c.errors)
+	}
+	return c.errors[0]
+}
@@ -0,0 +1,250 @@
+package jsonschema
+
+import (
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FormatChecker reports whether the value conforms to a format.
+// Values of every JSON type are passed, so it should return true for the types the format does not apply to.
+type FormatChecker func(value interface{}) bool
+
+// UnknownFormatPolicy decides what to do with a format which has no checker.
+type UnknownFormatPolicy int
+
+const (
+	// UnknownFormatPolicy_Ignore treats unknown formats as annotations. (default)
+	UnknownFormatPolicy_Ignore UnknownFormatPolicy = iota
+	// UnknownFormatPolicy_Warn treats unknown formats as annotations, and reports them by Validator.Warnings.
+	UnknownFormatPolicy_Warn
+	// UnknownFormatPolicy_Fail makes the compilation fail with ErrUnknownFormat.
+	UnknownFormatPolicy_Fail
+)
+
+// formatCheckers holds the checkers registered to all validators.
+var formatCheckers = struct {
+	sync.RWMutex
+	checkers map[string]FormatChecker
+}{
+	checkers: map[string]FormatChecker{
+		"date-time":     stringFormat(isDateTime),
+		"date":          stringFormat(isDate),
+		"time":          stringFormat(isTime),
+		"duration":      stringFormat(isDuration),
+		"email":         stringFormat(isEmail),
+		"hostname":      stringFormat(isHostname),
+		"ipv4":          stringFormat(isIPv4),
+		"ipv6":          stringFormat(isIPv6),
+		"uri":           stringFormat(isURI),
+		"uri-reference": stringFormat(isURIReference),
+		"uuid":          stringFormat(isUUID),
+		"json-pointer":  stringFormat(isJsonPointer),
+		"regex":         stringFormat(isRegex),
+	},
+}
+
+// RegisterFormat registers the checker of the format to all validators.
+// It overrides the checker of the same name, including the standard formats.
+func RegisterFormat(name string, checker FormatChecker) {
+	formatCheckers.Lock()
+	defer formatCheckers.Unlock()
+
+	formatCheckers.checkers[name] = checker
+}
+
+func getFormatChecker(name string) (FormatChecker, bool) {
+	formatCheckers.RLock()
+	defer formatCheckers.RUnlock()
+
+	checker, ok := formatCheckers.checkers[name]
+	return checker, ok
+}
+
+// stringFormat returns a checker which applies fn to strings only.
+func stringFormat(fn func(string) bool) FormatChecker {
+	return func(value interface{}) bool {
+		s, ok := value.(string)
+		if !ok {
+			return true
+		}
+		return fn(s)
+	}
+}
+
+var (
+	dateRegexp     = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+	timeRegexp     = regexp.MustCompile(`^(\d{2}):(\d{2}):(\d{2})(\.\d+)?([zZ]|([+-])(\d{2}):(\d{2}))$`)
+	durationRegexp = regexp.MustCompile(`^P(\d+W|(\d+Y(\d+M(\d+D)?)?|\d+M(\d+D)?|\d+D)(T(\d+H(\d+M(\d+S)?)?|\d+M(\d+S)?|\d+S))?|T(\d+H(\d+M(\d+S)?)?|\d+M(\d+S)?|\d+S))$`)
+	uuidRegexp     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	labelRegexp    = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+)
+
+// isDateTime checks date-time defined at RFC3339 section 5.6.
+func isDateTime(s string) bool {
+	i := strings.IndexAny(s, "tT")
+	if i < 0 {
+		return false
+	}
+	return isDate(s[:i]) && isTime(s[i+1:])
+}
+
+// isDate checks full-date defined at RFC3339 section 5.6.
+func isDate(s string) bool {
+	m := dateRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+
+	days := []int{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+	if year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+		days[1] = 29
+	}
+	return 1 <= month && month <= 12 && 1 <= day && day <= days[month-1]
+}
+
+// isTime checks full-time defined at RFC3339 section 5.6.
+func isTime(s string) bool {
+	m := timeRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	second, _ := strconv.Atoi(m[3])
+	if hour > 23 || minute > 59 || second > 60 {
+		return false
+	}
+
+	offset := 0
+	if m[6] != "" {
+		offsetHour, _ := strconv.Atoi(m[7])
+		offsetMinute, _ := strconv.Atoi(m[8])
+		if offsetHour > 23 || offsetMinute > 59 {
+			return false
+		}
+
+		offset = offsetHour*60 + offsetMinute
+		if m[6] == "-" {
+			offset = -offset
+		}
+	}
+
+	// leap second is allowed only at the end of a day in UTC.
+	if second == 60 {
+		utc := ((hour*60+minute-offset)%(24*60) + 24*60) % (24 * 60)
+		return utc == 23*60+59
+	}
+	return true
+}
+
+// isDuration checks duration defined at RFC3339 Appendix A.
+func isDuration(s string) bool {
+	return durationRegexp.MatchString(s)
+}
+
+// isEmail checks addr-spec defined at RFC5322 section 3.4.1.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s && addr.Name == ""
+}
+
+// isHostname checks hostname defined at RFC1123 section 2.1.
+func isHostname(s string) bool {
+	if len(s) == 0 || len(s) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(s, ".") {
+		if !labelRegexp.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// isIPv4 checks dotted-quad defined at RFC2673 section 3.2.
+func isIPv4(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return false
+	}
+
+	for _, part := range parts {
+		if len(part) == 0 || len(part) > 3 || (len(part) > 1 && part[0] == '0') {
+			return false
+		}
+		for _, c := range part {
+			if c < '0' || '9' < c {
+				return false
+			}
+		}
+		if n, _ := strconv.Atoi(part); n > 255 {
+			return false
+		}
+	}
+	return true
+}
+
+// isIPv6 checks IPv6 address defined at RFC4291 section 2.2.
+func isIPv6(s string) bool {
+	return strings.Contains(s, ":") && !strings.Contains(s, "%") && net.ParseIP(s) != nil
+}
+
+// isURI checks URI defined at RFC3986 section 3.
+func isURI(s string) bool {
+	u, ok := parseURIReference(s)
+	return ok && u.IsAbs()
+}
+
+// isURIReference checks URI-reference defined at RFC3986 section 4.1.
+func isURIReference(s string) bool {
+	_, ok := parseURIReference(s)
+	return ok
+}
+
+func parseURIReference(s string) (*url.URL, bool) {
+	// characters which are not allowed anywhere in URI.
+	for _, c := range s {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("\\\"<>^`{|}", c) {
+			return nil, false
+		}
+	}
+
+	u, err := url.Parse(s)
+	return u, err == nil
+}
+
+// isUUID checks UUID defined at RFC4122 section 3.
+func isUUID(s string) bool {
+	return uuidRegexp.MatchString(s)
+}
+
+// isJsonPointer checks JSON pointer defined at RFC6901 section 3.
+func isJsonPointer(s string) bool {
+	if s != "" && !strings.HasPrefix(s, "/") {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '~' && (i+1 == len(s) || (s[i+1] != '0' && s[i+1] != '1')) {
+			return false
+		}
+	}
+	return true
+}
+
+// isRegex checks regular expression in ECMA-262 dialect.
+func isRegex(s string) bool {
+	_, err := RegexpEngine_ECMA262(s, 0)
+	return err == nil
+}
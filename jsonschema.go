@@ -3,10 +3,10 @@ package jsonschema
 import (
 	"encoding/json"
 	"errors"
-	"github.com/umisama/jsonptr"
-	"io/ioutil"
+	"fmt"
 	"math"
-	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -14,27 +14,77 @@ var (
 	ErrInvalidTypeName      = errors.New("jsonschema: invalid type name")
 	ErrInvalidSchemaVersion = errors.New("jsonschema: invalid schema version")
 	ErrInvalidSchemaFormat  = errors.New("jsonschema: invalid schema format")
+	ErrUnknownFormat        = errors.New("jsonschema: unknown format")
+	ErrInvalidResourceURI   = errors.New("jsonschema: invalid resource URI")
+	ErrInvalidReference     = errors.New("jsonschema: invalid reference")
+	ErrUnresolvedReference  = errors.New("jsonschema: unresolved reference")
+	ErrInvalidOutputFormat  = errors.New("jsonschema: invalid output format")
+	ErrRegexpTimeout        = errors.New("jsonschema: regular expression timed out")
+	ErrInfiniteRecursion    = errors.New("jsonschema: infinite recursion of schemas")
 	errFoundReference       = errors.New("notify found reference")
 )
 
+// SchemaError represents a failure of compiling a schema.
+// It matches the sentinel error of the failure with errors.Is. (e.g. ErrInvalidSchemaFormat)
+// Violations against the meta-schema are found before compilation, and reported as SchemaErrors in an InvalidSchemaError.
+type SchemaError struct {
+	// Pointer is a JSON pointer to the invalid part of the schema. (e.g. "#/properties/age/minimum")
+	Pointer string
+	// Keyword is the name of the invalid keyword. (empty if the schema itself is invalid)
+	Keyword string
+	// Value is the invalid value.
+	Value interface{}
+	// Message is a human-readable description of the failure.
+	Message string
+
+	err error
+}
+
+func newSchemaError(pointer, keyword string, value interface{}, err error, format string, args ...interface{}) error {
+	return &SchemaError{
+		Pointer: pointer,
+		Keyword: keyword,
+		Value:   value,
+		Message: fmt.Sprintf(format, args...),
+		err:     err,
+	}
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("jsonschema: %s at '%s'", e.Message, e.Pointer)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.err
+}
+
 type SchemaType string
 
 const (
 	SchemaType_Draft3   = "http://json-schema.org/draft-03/schema#"
 	SchemaType_Draft4   = "http://json-schema.org/draft-04/schema#"
+	SchemaType_Draft6   = "http://json-schema.org/draft-06/schema#"
+	SchemaType_Draft7   = "http://json-schema.org/draft-07/schema#"
 	SchemaType_Standard = "http://json-schema.org/schema#"
 	SchemaType_Unknown  = "unknown"
+
+	SchemaType_Draft2019_09 = "https://json-schema.org/draft/2019-09/schema"
+	SchemaType_Draft2020_12 = "https://json-schema.org/draft/2020-12/schema"
 )
 
 func GetSchemaType(typestr string) (t SchemaType) {
 	types := []SchemaType{
 		SchemaType_Draft3,
 		SchemaType_Draft4,
+		SchemaType_Draft6,
+		SchemaType_Draft7,
+		SchemaType_Draft2019_09,
+		SchemaType_Draft2020_12,
 		SchemaType_Standard,
 	}
 
 	for _, v := range types {
-		if typestr == v.String() {
+		if normalizeSchemaURI(typestr) == normalizeSchemaURI(v.String()) {
 			return v
 		}
 	}
@@ -84,6 +134,28 @@ func (j JsonType) String() string {
 	return string(j)
 }
 
+// getJsonTypeOf returns the primitive type of a decoded json value.
+func getJsonTypeOf(v interface{}) JsonType {
+	switch v := v.(type) {
+	case nil:
+		return JsonType_Null
+	case bool:
+		return JsonType_Bool
+	case float64:
+		if math.Mod(v, 1) == 0 {
+			return JsonType_Integer
+		}
+		return JsonType_Number
+	case string:
+		return JsonType_String
+	case []interface{}:
+		return JsonType_Array
+	case map[string]interface{}:
+		return JsonType_Object
+	}
+	return JsonType_INVALID
+}
+
 func (j JsonType) IsMatched(v interface{}) (ret bool) {
 	switch j {
 	case JsonType_Any:
@@ -112,64 +184,294 @@ func (j JsonType) IsMatched(v interface{}) (ret bool) {
 	return
 }
 
+// refResolver finds the schemas referred by "$ref".
+// URIs of the references are resolved against the base URI of the referring schema. (defined at RFC3986 section 5)
 type refResolver struct {
-	originals         map[string]map[string]interface{}
-	cached            map[string]*schemaProperty
-	outherfile_schema map[string]*schemaProperty
+	// resources holds the raw schemas identified by absolute URIs without fragment. (documents and embedded schema resources)
+	resources map[string]*rawResource
+	// anchors holds the raw schemas identified by URIs with plain name fragment.
+	anchors map[string]*rawResource
+
+	// cached holds the compiled schemas by their URIs. They are shared by all the references to them,
+	// and may be under compilation when referred, so that recursive references never expand infinitely.
+	cached    map[string]*schemaProperty
+	validator *Validator
+}
+
+// rawResource represents a raw schema with the base URI and the dialect to recognize it.
+type rawResource struct {
+	raw interface{}
+	// base is the base URI of the parent, which the id of raw is resolved against.
+	base    string
+	dialect *dialect
+	// resource reports whether raw is the root of a schema resource. (a document or a schema with id)
+	resource bool
+}
+
+func newRefResolver(schema interface{}, d *dialect, validator *Validator) (*refResolver, error) {
+	r := &refResolver{
+		resources: make(map[string]*rawResource),
+		anchors:   make(map[string]*rawResource),
+		cached:    make(map[string]*schemaProperty),
+		validator: validator,
+	}
+
+	r.resources[""] = &rawResource{raw: schema, base: "", dialect: d, resource: true}
+	r.index(schema, "", d)
+	return r, nil
+}
+
+// index registers the embedded schema resources and anchors in the raw schema.
+func (r *refResolver) index(raw interface{}, base string, d *dialect) {
+	switch obj := raw.(type) {
+	case map[string]interface{}:
+		parent := base
+		d = resourceDialect(obj, d, r.validator)
+		if id, ok := schemaId(obj, d); ok {
+			uri, err := resolveURI(base, id)
+			if err == nil {
+				var fragment string
+				base, fragment = splitFragment(uri)
+				if !strings.HasPrefix(id, "#") {
+					r.resources[base] = &rawResource{raw: obj, base: parent, dialect: d, resource: true}
+				}
+				if fragment != "" {
+					// a plain name fragment in id until draft7. (e.g. {"$id": "#foo"})
+					r.anchors[uri] = &rawResource{raw: obj, base: parent, dialect: d}
+				}
+			}
+		}
+
+		for _, keyword := range d.anchorKeywords {
+			if name, ok := obj[keyword].(string); ok {
+				r.anchors[base+"#"+name] = &rawResource{raw: obj, base: parent, dialect: d}
+			}
+		}
+
+		for k, v := range obj {
+			if k == "enum" || k == "const" {
+				// not schemas
+				continue
+			}
+			r.index(v, base, d)
+		}
+
+	case []interface{}:
+		for _, v := range obj {
+			r.index(v, base, d)
+		}
+	}
+}
+
+// GetReferencedObject returns the compiled schema referred by path from the reference at location in the schema m.
+// A remote document is loaded once, and the fragment is resolved inside it. (the references in it are relative to it)
+// The referred schema is located under the first reference to it, which is replaced by the referring one on evaluation.
+func (r *refResolver) GetReferencedObject(path, location string, m *schemaProperty) (*schemaProperty, error) {
+	uri, err := resolveURI(m.base, path)
+	if err != nil {
+		return r.unresolved(path, location, m, ErrInvalidReference, err)
+	}
+
+	uri = strings.TrimSuffix(uri, "#")
+	if obj, ok := r.cached[uri]; ok {
+		return obj, nil
+	}
+
+	res, err := r.find(uri, m.dialect)
+	if err != nil {
+		return r.unresolved(path, location, m, ErrUnresolvedReference, err)
+	}
+	if res == nil {
+		return r.unresolved(path, location, m, ErrUnresolvedReference, nil)
+	}
+
+	// the referred schema is recognized by its own dialect, which may differ from the referring one. (e.g. remote documents)
+	dst := m.NewBrother()
+	dst.base = res.base
+	dst.dialect = res.dialect
+	dst.location = location
+	if res.resource {
+		newSchemaResource(dst)
+	}
+
+	r.cached[uri] = dst
+	err = dst.RecognizeSchema(res.raw)
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// unresolved reports the reference at location which refers to nothing.
+// It is compiled as an empty schema with WithLenientReferences, and reported by Warnings.
+func (r *refResolver) unresolved(path, location string, m *schemaProperty, sentinel, cause error) (*schemaProperty, error) {
+	msg := fmt.Sprintf("%s %q", strings.TrimPrefix(sentinel.Error(), "jsonschema: "), path)
+	if cause != nil {
+		msg = fmt.Sprintf("%s: %v", msg, cause)
+	}
+	// the location ends with the keyword of the reference. (e.g. "#/properties/a/$ref")
+	keyword := location[strings.LastIndex(location, "/")+1:]
+	err := newSchemaError(location, keyword, path, sentinel, "%s", msg)
+
+	v := r.validator
+	if !v.lenientReferences {
+		return nil, err
+	}
+	v.warnings = append(v.warnings, err.Error())
+
+	dst := m.NewBrother()
+	dst.location = location
+	return dst, dst.RecognizeSchema(make(map[string]interface{}))
+}
+
+// register shares the compiled schema identified by the URI with the references to it.
+func (r *refResolver) register(uri string, s *schemaProperty) {
+	uri = strings.TrimSuffix(uri, "#")
+	if _, ok := r.cached[uri]; !ok {
+		r.cached[uri] = s
+	}
+}
+
+// find returns the raw schema identified by the URI, or nil if not found.
+func (r *refResolver) find(uri string, d *dialect) (*rawResource, error) {
+	doc, fragment := splitFragment(uri)
+	res, ok := r.resources[doc]
+	if !ok {
+		var err error
+		res, err = r.load(doc, d)
+		if err != nil || res == nil {
+			return nil, err
+		}
+	}
+
+	if fragment == "" {
+		return res, nil
+	}
+
+	if !strings.HasPrefix(fragment, "/") {
+		// plain name fragment
+		return r.anchors[uri], nil
+	}
+
+	// the fragment is percent-encoded in the URI. (defined at RFC6901 section 6)
+	pointer, err := url.PathUnescape(fragment)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePointer(res, pointer, r.validator)
 }
 
-func newRefResolver(schema map[string]interface{}) (*refResolver, error) {
-	return &refResolver{
-		originals:         map[string]map[string]interface{}{"#": schema},
-		cached:            make(map[string]*schemaProperty),
-		outherfile_schema: make(map[string]*schemaProperty),
-	}, nil
+// resolvePointer returns the value referred by the JSON pointer in the raw schema. (defined at RFC6901 section 4)
+// The base URI and the dialect of the value are changed by the schema resources on the way.
+func resolvePointer(res *rawResource, pointer string, v *Validator) (*rawResource, error) {
+	raw, base, d := res.raw, res.base, res.dialect
+	for _, token := range strings.Split(pointer, "/")[1:] {
+		token = unescapeJsonPointer(token)
+
+		switch obj := raw.(type) {
+		case map[string]interface{}:
+			d = resourceDialect(obj, d, v)
+			if id, ok := schemaId(obj, d); ok {
+				uri, err := resolveURI(base, id)
+				if err != nil {
+					return nil, err
+				}
+				base, _ = splitFragment(uri)
+			}
+
+			v, ok := obj[token]
+			if !ok {
+				return nil, fmt.Errorf("no value at %s", pointer)
+			}
+			raw = v
+
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(obj) || strconv.Itoa(i) != token {
+				// the index must be digits without leading zeros.
+				return nil, fmt.Errorf("no value at %s", pointer)
+			}
+			raw = obj[i]
+
+		default:
+			return nil, fmt.Errorf("no value at %s", pointer)
+		}
+	}
+
+	return &rawResource{raw: raw, base: base, dialect: d}, nil
 }
 
-func (r *refResolver) GetReferencedObject(path string, dst *schemaProperty) error {
-	if obj, ok := r.cached[path]; ok {
-		*dst = *obj
-		return nil
+// load retrieves the document of the URI, and registers it and its embedded schema resources.
+// The registered resources are used before the loader.
+// Relative URIs, which are found in schemas without absolute ids, are never loaded.
+func (r *refResolver) load(uri string, d *dialect) (*rawResource, error) {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() {
+		return nil, nil
 	}
 
-	raw := make(map[string]interface{})
-	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
-		raw = r.getReferenceObjectViaHttp(path)
-		dst.original = path
-	} else {
-		raw = r.getReferecneObjectViaJsonPtr(path, dst.original)
+	buf, ok := getResource(uri, r.validator)
+	if !ok {
+		buf, err = r.validator.loader.Load(uri)
+		if err != nil {
+			return nil, fmt.Errorf("jsonschema: load %s: %w", uri, err)
+		}
 	}
 
-	r.cached[path] = dst
-	err := dst.Recognize(raw)
+	var raw interface{}
+	err = json.Unmarshal(buf, &raw)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("jsonschema: load %s: %w", uri, err)
 	}
-	return nil
+
+	if obj, ok := raw.(map[string]interface{}); ok {
+		// the document may declare another dialect. (e.g. meta-schemas)
+		if s, ok := obj["$schema"].(string); ok {
+			if dd, err := findDialect(s, r.validator); err == nil {
+				d = dd
+			}
+		}
+	}
+
+	res := &rawResource{raw: raw, base: uri, dialect: d, resource: true}
+	r.resources[uri] = res
+	r.index(raw, uri, d)
+	return res, nil
 }
 
-func (r *refResolver) getReferecneObjectViaJsonPtr(path string, original string) map[string]interface{} {
-	buf, _ := json.Marshal(r.originals[original])
-	ret_buf, _ := jsonptr.Find(buf, path)
+// schemaId returns the id of the raw schema. It is ignored beside "$ref" until draft7.
+func schemaId(schema map[string]interface{}, d *dialect) (string, bool) {
+	id, ok := schema[d.idKeyword].(string)
+	if !ok {
+		return "", false
+	}
 
-	ret := make(map[string]interface{})
-	json.Unmarshal(ret_buf, &ret)
-	return ret
+	if _, ok := schema["$ref"]; ok && !d.refApplicator {
+		return "", false
+	}
+	return id, true
 }
 
-func (r *refResolver) getReferenceObjectViaHttp(path string) map[string]interface{} {
-	resp, err := http.Get(path)
+// resolveURI resolves the URI reference against the base URI. (defined at RFC3986 section 5.2)
+func resolveURI(base, ref string) (string, error) {
+	b, err := url.Parse(base)
 	if err != nil {
-		return nil
+		return "", err
 	}
 
-	buf, err := ioutil.ReadAll(resp.Body)
+	u, err := url.Parse(ref)
 	if err != nil {
-		return nil
+		return "", err
 	}
 
-	ret := make(map[string]interface{})
-	json.Unmarshal(buf, &ret)
-	r.originals[path] = ret
-	return ret
+	return b.ResolveReference(u).String(), nil
+}
+
+// splitFragment splits the URI into the URI without fragment and the fragment.
+func splitFragment(uri string) (string, string) {
+	i := strings.Index(uri, "#")
+	if i < 0 {
+		return uri, ""
+	}
+	return uri[:i], uri[i+1:]
 }
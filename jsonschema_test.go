@@ -1 +1,1445 @@
 package jsonschema
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// validityCase is a document with its expected validity.
+type validityCase struct {
+	data  string
+	valid bool
+}
+
+// testValidity validates each document, and reports unexpected results and errors which stopped the validation.
+func testValidity(t *testing.T, validator *Validator, cases []validityCase) {
+	t.Helper()
+	for i, c := range cases {
+		valid, err := validator.IsValid([]byte(c.data))
+		if err != nil {
+			t.Error(i, "fail on IsValid of", c.data, "with", err)
+		} else if valid != c.valid {
+			t.Error(i, "expected", c.valid, "but got", valid, "on", c.data)
+		}
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	schema := []byte(`{
+		"properties": {
+			"age": {"type": "integer", "minimum": 18},
+			"tags": {"items": {"type": "string"}},
+			"a/b": {"enum": [1]}
+		},
+		"required": ["age"]
+	}`)
+
+	validator, err := NewValidator(schema)
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	cases := []struct {
+		document         string
+		instanceLocation string
+		keywordLocation  string
+		keyword          string
+	}{
+		{`{"age": 10}`, "/age", "#/properties/age/minimum", "minimum"},
+		{`{"age": "10"}`, "/age", "#/properties/age/type", "type"},
+		{`{}`, "", "#/required", "required"},
+		{`{"age": 20, "tags": ["a", 1]}`, "/tags/1", "#/properties/tags/items/type", "type"},
+		{`{"age": 20, "a/b": 2}`, "/a~1b", "#/properties/a~1b/enum", "enum"},
+	}
+
+	for _, c := range cases {
+		err := validator.Validate([]byte(c.document))
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Error("expected *ValidationError on", c.document, "but got", err)
+			continue
+		}
+
+		if verr.InstanceLocation != c.instanceLocation || verr.KeywordLocation != c.keywordLocation || verr.Keyword != c.keyword {
+			t.Error("unexpected error on", c.document, ":", verr.InstanceLocation, verr.KeywordLocation, verr.Keyword)
+		}
+	}
+
+	if err := validator.Validate([]byte(`{"age": 20, "tags": ["a"]}`)); err != nil {
+		t.Error("expected valid, but got", err)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	schema := []byte(`{
+		"properties": {
+			"name": {"type": "string", "minLength": 2},
+			"age": {"type": "integer", "minimum": 18}
+		},
+		"required": ["name", "age", "email"]
+	}`)
+
+	validator, err := NewValidator(schema, WithExhaustive(0))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	err = validator.Validate([]byte(`{"name": "a", "age": 1.5}`))
+	verrs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatal("expected ValidationErrors, but got", err)
+	}
+
+	// minLength of name, type and minimum of age, required of email
+	if len(verrs) != 4 {
+		t.Error("expected 4 errors, but got", len(verrs), verrs)
+	}
+
+	limited, err := NewValidator(schema, WithExhaustive(2))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	err = limited.Validate([]byte(`{"name": "a", "age": 1.5}`))
+	if verrs, ok := err.(ValidationErrors); !ok || len(verrs) != 2 {
+		t.Error("expected 2 errors, but got", err)
+	}
+}
+
+func TestValidationErrorsOrder(t *testing.T) {
+	schema := []byte(`{
+		"properties": {"a": {"type": "string"}, "b": {"type": "string"}, "c": {"type": "string"}},
+		"patternProperties": {"^p": {"type": "string"}, "^q": {"type": "string"}},
+		"additionalProperties": {"type": "string"},
+		"dependencies": {"a": ["x"], "b": ["y"], "c": {"required": ["z"]}}
+	}`)
+	document := []byte(`{"a": 1, "b": 2, "c": 3, "p1": 4, "p2": 5, "q1": 6, "r1": 7, "r2": 8}`)
+
+	for _, opts := range [][]Option{nil, {WithExhaustive(0)}, {WithExhaustive(2)}} {
+		validator, err := NewValidator(schema, opts...)
+		if err != nil {
+			t.Fatal("fail on NewValidator with", err)
+		}
+
+		// the order of map iteration changes on every run.
+		expect := validator.Validate(document).Error()
+		for i := 0; i < 50; i++ {
+			if actual := validator.Validate(document).Error(); actual != expect {
+				t.Fatal("unstable errors:", expect, "and", actual)
+			}
+		}
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	schema := []byte(`{
+		"properties": {
+			"a": {"type": "integer"},
+			"b": {"anyOf": [{"type": "string"}, {"minimum": 10}]}
+		}
+	}`)
+	document := []byte(`{"a": 1, "b": 2}`)
+
+	cases := []struct {
+		format OutputFormat
+		expect string
+	}{
+		{OutputFormat_Flag, `{"valid":false}`},
+		{OutputFormat_Basic, `{"valid":false,"keywordLocation":"#","instanceLocation":"","errors":[
+			{"valid":false,"keywordLocation":"#/properties/b/anyOf","instanceLocation":"/b","error":"must be valid against at least one of the subschemas"}
+		]}`},
+		{OutputFormat_Detailed, `{"valid":false,"keywordLocation":"#","instanceLocation":"","errors":[
+			{"valid":false,"keywordLocation":"#/properties/b/anyOf","instanceLocation":"/b","error":"must be valid against at least one of the subschemas","errors":[
+				{"valid":false,"keywordLocation":"#/properties/b/anyOf/0/type","instanceLocation":"/b","error":"expected [string], but got integer"},
+				{"valid":false,"keywordLocation":"#/properties/b/anyOf/1/minimum","instanceLocation":"/b","error":"must be greater than or equal to 10, but got 2"}
+			]}
+		]}`},
+	}
+
+	for _, c := range cases {
+		validator, err := NewValidator(schema, WithOutputFormat(c.format))
+		if err != nil {
+			t.Fatal("fail on NewValidator with", err)
+		}
+
+		out, err := validator.Output(document)
+		if err != nil {
+			t.Error("fail on Output with", err)
+			continue
+		}
+
+		var actual, expect interface{}
+		json.Unmarshal(out, &actual)
+		json.Unmarshal([]byte(c.expect), &expect)
+		if !reflect.DeepEqual(actual, expect) {
+			t.Error("unexpected output of", c.format, ":", string(out))
+		}
+	}
+
+	validator, err := NewValidator(schema, WithOutputFormat(OutputFormat_Verbose))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	out, err := validator.Output([]byte(`{"a": 1, "b": "x"}`))
+	if err != nil {
+		t.Fatal("fail on Output with", err)
+	}
+
+	unit := new(OutputUnit)
+	json.Unmarshal(out, unit)
+	if !unit.Valid || len(unit.Annotations) != 2 {
+		t.Error("unexpected output of verbose:", string(out))
+	}
+
+	// every failure is reported without WithExhaustive.
+	for _, format := range []OutputFormat{OutputFormat_Basic, OutputFormat_Detailed, OutputFormat_Verbose} {
+		validator, err := NewValidator(schema, WithOutputFormat(format))
+		if err != nil {
+			t.Fatal("fail on NewValidator with", err)
+		}
+
+		out, err := validator.Output([]byte(`{"a": "x", "b": 2}`))
+		if err != nil {
+			t.Fatal("fail on Output with", err)
+		}
+		if !strings.Contains(string(out), "#/properties/a/type") || !strings.Contains(string(out), "#/properties/b/anyOf") {
+			t.Error("expected both failures in", format, ":", string(out))
+		}
+	}
+
+	_, err = NewValidator(schema, WithOutputFormat("unknown"))
+	if err != ErrInvalidOutputFormat {
+		t.Error("expected ErrInvalidOutputFormat, but got", err)
+	}
+}
+
+func TestValidatorUnmarshal(t *testing.T) {
+	validator, err := NewValidator([]byte(`{
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer", "minimum": 0}
+		},
+		"required": ["name"]
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	type person struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	p := person{}
+	err = validator.Unmarshal([]byte(`{"name": "umisama", "age": 20}`), &p)
+	if err != nil || p.Name != "umisama" || p.Age != 20 {
+		t.Error("unexpected result:", p, err)
+	}
+
+	p = person{}
+	err = validator.Unmarshal([]byte(`{"name": "umisama", "age": -1}`), &p)
+	if _, ok := err.(*ValidationError); !ok {
+		t.Error("expected *ValidationError, but got", err)
+	}
+	if p.Name != "" {
+		t.Error("dst must not be modified on invalid document:", p)
+	}
+
+	m := make(map[string]interface{})
+	err = validator.Unmarshal([]byte(`{"name": "umisama"}`), &m)
+	if err != nil || m["name"] != "umisama" {
+		t.Error("unexpected result:", m, err)
+	}
+}
+
+func TestValidatorMarshal(t *testing.T) {
+	validator, err := NewValidator([]byte(`{
+		"properties": {
+			"name": {"type": "string", "minLength": 1}
+		},
+		"required": ["name"]
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	type person struct {
+		Name string `json:"name"`
+	}
+
+	buf, err := validator.Marshal(person{Name: "umisama"})
+	if err != nil || string(buf) != `{"name":"umisama"}` {
+		t.Error("unexpected result:", string(buf), err)
+	}
+
+	buf, err = validator.Marshal(person{})
+	if _, ok := err.(*ValidationError); !ok || buf != nil {
+		t.Error("expected *ValidationError, but got", string(buf), err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema := []byte(`{"type": "string"}`)
+
+	if err := Validate(schema, []byte(`"a"`)); err != nil {
+		t.Error("expected valid, but got", err)
+	}
+
+	if _, ok := Validate(schema, []byte(`1`)).(*ValidationError); !ok {
+		t.Error("expected *ValidationError")
+	}
+
+	if err := Validate([]byte(`{"type": "unknown"}`), []byte(`1`)); !errors.Is(err, ErrInvalidTypeName) {
+		t.Error("expected ErrInvalidTypeName, but got", err)
+	}
+
+	// a schema which is loading its references does not block the other schemas.
+	entered, release := make(chan bool), make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- true
+		<-release
+		w.Write([]byte(`{"type": "integer"}`))
+	}))
+	defer server.Close()
+
+	slow := make(chan error, 1)
+	go func() {
+		slow <- Validate([]byte(`{"$ref": "`+server.URL+`/slow.json"}`), []byte(`1`))
+	}()
+	<-entered
+
+	fast := make(chan error, 1)
+	go func() {
+		fast <- Validate(schema, []byte(`"a"`))
+	}()
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Error("expected valid, but got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("blocked by the schema under compilation")
+	}
+
+	close(release)
+	if err := <-slow; err != nil {
+		t.Error("expected valid, but got", err)
+	}
+
+	// the cache holds only the recently used schemas.
+	for i := 0; i <= maxCachedValidators; i++ {
+		if err := Validate([]byte(`{"maximum": `+strconv.Itoa(i)+`}`), []byte(`0`)); err != nil {
+			t.Fatal(i, "expected valid, but got", err)
+		}
+	}
+	validatorCache.Lock()
+	_, cached := validatorCache.validators[sha256.Sum256([]byte(`{"maximum": 0}`))]
+	size := len(validatorCache.validators)
+	validatorCache.Unlock()
+	if cached || size != maxCachedValidators {
+		t.Error("expected the least recently used schema to be dropped, but got", cached, size)
+	}
+}
+
+// run with -race to detect shared state between validations.
+func TestValidatorConcurrency(t *testing.T) {
+	validator, err := NewValidator([]byte(`{
+		"properties": {"a": {"type": "integer"}},
+		"patternProperties": {"^b": {"type": "string"}},
+		"additionalProperties": false
+	}`), WithOutputFormat(OutputFormat_Verbose))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	cases := []struct {
+		document string
+		valid    bool
+	}{
+		{`{"a": 1, "b1": "x"}`, true},
+		{`{"a": 1, "c": "x"}`, false},
+		{`{"b1": "x", "b2": "y"}`, true},
+		{`{"a": "x"}`, false},
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		c := cases[i%len(cases)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			valid, err := validator.IsValid([]byte(c.document))
+			if err != nil || valid != c.valid {
+				t.Error("unexpected result on", c.document, ":", valid, err)
+			}
+			validator.Output([]byte(c.document))
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInvalidPatternProperties(t *testing.T) {
+	_, err := NewValidator([]byte(`{"patternProperties": {"[a-": {}}}`))
+	if !errors.Is(err, ErrInvalidSchemaFormat) {
+		t.Error("expected ErrInvalidSchemaFormat, but got", err)
+	}
+}
+
+func TestRegexpEngine(t *testing.T) {
+	schema := []byte(`{
+		"pattern": "^(?!admin)\\w+$",
+		"patternProperties": {"^(\\w)\\1$": {"type": "integer"}}
+	}`)
+
+	validator, err := NewValidator(schema)
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	cases := []struct {
+		document string
+		valid    bool
+	}{
+		{`"user"`, true},
+		{`"administrator"`, false},
+		{`{"aa": 1}`, true},
+		{`{"aa": "x"}`, false},
+		{`{"ab": "x"}`, true},
+	}
+
+	for _, c := range cases {
+		valid, err := validator.IsValid([]byte(c.document))
+		if err != nil || valid != c.valid {
+			t.Error("unexpected result on", c.document, ":", valid, err)
+		}
+	}
+
+	// \d matches only ASCII digits in ECMA-262.
+	validator, err = NewValidator([]byte(`{"pattern": "^\\d+$"}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	testValidity(t, validator, []validityCase{{`"٤٢"`, false}})
+
+	// re2 does not support lookaheads.
+	_, err = NewValidator(schema, WithRegexpEngine(RegexpEngine_RE2))
+	if !errors.Is(err, ErrInvalidSchemaFormat) {
+		t.Error("expected ErrInvalidSchemaFormat, but got", err)
+	}
+
+	// catastrophic backtracking is stopped by the timeout, instead of reported as "no match".
+	pathological := strings.Repeat("a", 28) + "b"
+	timeouts := []struct {
+		schema   string
+		document string
+	}{
+		{`{"pattern": "^(a+)+$"}`, `"` + pathological + `"`},
+		{`{"items": {"patternProperties": {"^(a+)+$": {}}}}`, `[{"` + pathological + `": 1}]`},
+	}
+
+	for _, c := range timeouts {
+		validator, err = NewValidator([]byte(c.schema), WithRegexpTimeout(50*time.Millisecond))
+		if err != nil {
+			t.Fatal("fail on NewValidator with", err)
+		}
+
+		start := time.Now()
+		valid, err := validator.IsValid([]byte(c.document))
+		if valid || !errors.Is(err, ErrRegexpTimeout) {
+			t.Error("expected ErrRegexpTimeout on", c.schema, "but got", valid, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Error("expected the timeout, but took", elapsed)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		format string
+		value  string
+		valid  bool
+	}{
+		{"date-time", "1963-06-19T08:30:06.283185Z", true},
+		{"date-time", "1990-12-31T15:59:60-08:00", true},
+		{"date-time", "1990-02-31T15:59:59Z", false},
+		{"date-time", "1963-06-19 08:30:06Z", false},
+		{"date", "2020-02-29", true},
+		{"date", "2021-02-29", false},
+		{"time", "08:30:06+09:00", true},
+		{"time", "08:30:06", false},
+		{"duration", "P4DT12H30M5S", true},
+		{"duration", "P1Y2W", false},
+		{"email", "joe.bloggs@example.com", true},
+		{"email", "Joe <joe@example.com>", false},
+		{"hostname", "www.example.com", true},
+		{"hostname", "-a.example.com", false},
+		{"ipv4", "192.168.0.1", true},
+		{"ipv4", "192.168.0.01", false},
+		{"ipv6", "::1", true},
+		{"ipv6", "12345::", false},
+		{"uri", "http://example.com/path?q=1#f", true},
+		{"uri", "//example.com", false},
+		{"uri-reference", "../path#f", true},
+		{"uri-reference", "\\\\WINDOWS\\fileshare", false},
+		{"uuid", "2eb8aa08-aa98-11ea-b4aa-73b441d16380", true},
+		{"uuid", "2eb8aa08aa9811eab4aa73b441d16380", false},
+		{"json-pointer", "/foo/bar~0/baz~1", true},
+		{"json-pointer", "/foo/bar~", false},
+		{"regex", "^[a-z]+(?=x)$", true},
+		{"regex", "^(abc]", false},
+	}
+
+	for _, c := range cases {
+		schema, _ := json.Marshal(map[string]string{"format": c.format})
+		document, _ := json.Marshal(c.value)
+
+		validator, err := NewValidator(schema)
+		if err != nil {
+			t.Fatal("fail on NewValidator with", err)
+		}
+
+		valid, err := validator.IsValid(document)
+		if err != nil || valid != c.valid {
+			t.Error("unexpected result on", c.format, c.value, ":", valid, err)
+		}
+
+		// format is an annotation only.
+		validator, err = NewValidator(schema, WithFormatAssertion(false))
+		if err != nil {
+			t.Fatal("fail on NewValidator with", err)
+		}
+
+		valid, err = validator.IsValid(document)
+		if err != nil || !valid {
+			t.Error("unexpected result on", c.format, c.value, ":", valid, err)
+		}
+	}
+}
+
+func TestFormatRegistry(t *testing.T) {
+	RegisterFormat("test-currency", func(v interface{}) bool {
+		s, ok := v.(string)
+		return !ok || s == "JPY" || s == "USD"
+	})
+
+	orderId := func(v interface{}) bool {
+		n, ok := v.(float64)
+		return ok && n > 0
+	}
+
+	schema := []byte(`{
+		"properties": {
+			"currency": {"format": "test-currency"},
+			"order": {"format": "order-id"}
+		}
+	}`)
+
+	validator, err := NewValidator(schema, WithFormat("order-id", orderId))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	cases := []struct {
+		document string
+		valid    bool
+	}{
+		{`{"currency": "JPY", "order": 1}`, true},
+		{`{"currency": "EUR"}`, false},
+		{`{"order": "1"}`, false},
+	}
+
+	for _, c := range cases {
+		valid, err := validator.IsValid([]byte(c.document))
+		if err != nil || valid != c.valid {
+			t.Error("unexpected result on", c.document, ":", valid, err)
+		}
+	}
+
+	// order-id is unknown without WithFormat.
+	validator, err = NewValidator(schema)
+	if err != nil || len(validator.Warnings()) != 0 {
+		t.Error("unexpected result:", err)
+	}
+
+	validator, err = NewValidator(schema, WithUnknownFormatPolicy(UnknownFormatPolicy_Warn))
+	if err != nil || len(validator.Warnings()) != 1 {
+		t.Error("unexpected result:", err)
+	}
+
+	_, err = NewValidator(schema, WithUnknownFormatPolicy(UnknownFormatPolicy_Fail))
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Error("expected ErrUnknownFormat, but got", err)
+	}
+}
+
+type testKeyword_divisibleBy struct {
+	value float64
+}
+
+func (k *testKeyword_divisibleBy) Validate(ctx *KeywordContext, instance interface{}) {
+	n, ok := instance.(float64)
+	if ok && math.Mod(n, k.value) != 0 {
+		ctx.AddError("must be divisible by %v", k.value)
+	}
+}
+
+// testKeyword_count counts the evaluations of the keyword.
+type testKeyword_count struct {
+	count *int
+}
+
+func (k *testKeyword_count) Validate(ctx *KeywordContext, instance interface{}) {
+	*k.count++
+}
+
+func TestCustomKeyword(t *testing.T) {
+	errZero := errors.New("must be a non-zero number")
+	compiler := func(value interface{}, schema map[string]interface{}) (KeywordValidator, error) {
+		n, ok := value.(float64)
+		if !ok || n == 0 {
+			return nil, errZero
+		}
+		return &testKeyword_divisibleBy{value: n}, nil
+	}
+
+	validator, err := NewValidator([]byte(`{
+		"properties": {"a": {"x-divisibleBy": 3}}
+	}`), WithKeyword("x-divisibleBy", compiler))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	if valid, err := validator.IsValid([]byte(`{"a": 9}`)); !valid || err != nil {
+		t.Error("expected valid, but got", err)
+	}
+
+	err = validator.Validate([]byte(`{"a": 10}`))
+	verr, ok := err.(*ValidationError)
+	if !ok || verr.InstanceLocation != "/a" || verr.KeywordLocation != "#/properties/a/x-divisibleBy" || verr.Keyword != "x-divisibleBy" {
+		t.Error("unexpected error:", err)
+	}
+
+	_, err = NewValidator([]byte(`{"x-divisibleBy": 0}`), WithKeyword("x-divisibleBy", compiler))
+	if !errors.Is(err, ErrInvalidSchemaFormat) || !errors.Is(err, errZero) {
+		t.Error("expected ErrInvalidSchemaFormat with the error of the compiler, but got", err)
+	}
+}
+
+func TestBooleanSchema(t *testing.T) {
+	cases := []struct {
+		schema string
+		data   string
+		valid  bool
+	}{
+		{`true`, `1`, true},
+		{`false`, `1`, false},
+		{`{"$schema": "http://json-schema.org/draft-07/schema#", "properties": {"a": false}}`, `{"a": 1}`, false},
+		{`{"$schema": "http://json-schema.org/draft-07/schema#", "properties": {"a": false}}`, `{"b": 1}`, true},
+		{`{"$schema": "http://json-schema.org/draft-07/schema#", "if": {"minimum": 0}, "then": true, "else": false}`, `-1`, false},
+	}
+
+	for i, c := range cases {
+		validator, err := NewValidator([]byte(c.schema), WithDefaultDialect(SchemaType_Draft7))
+		if err != nil {
+			t.Error(i, "fail on NewValidator with", err)
+			continue
+		}
+
+		if valid, err := validator.IsValid([]byte(c.data)); valid != c.valid || err != nil {
+			t.Error(i, "expected", c.valid, "but got", valid, err)
+		}
+	}
+
+	// boolean schemas are not allowed before draft6, even at the root.
+	if _, err := NewValidator([]byte(`{"properties": {"a": false}}`)); err == nil {
+		t.Error("expected error on boolean schema in draft4")
+	}
+	for _, validation := range []bool{false, true} {
+		_, err := NewValidator([]byte(`true`), WithSchemaValidation(validation))
+		var serr *SchemaError
+		if !errors.As(err, &serr) || serr.Pointer != "#" || !errors.Is(err, ErrInvalidSchemaFormat) {
+			t.Error(validation, "expected a SchemaError on boolean schema in draft4, but got", err)
+		}
+	}
+}
+
+func TestUnevaluated(t *testing.T) {
+	cases := []struct {
+		schema string
+		data   string
+		valid  bool
+	}{
+		{`{"allOf": [{"properties": {"a": true}}], "properties": {"b": true}, "unevaluatedProperties": false}`, `{"a": 1, "b": 1}`, true},
+		{`{"allOf": [{"properties": {"a": true}}], "properties": {"b": true}, "unevaluatedProperties": false}`, `{"a": 1, "c": 1}`, false},
+		{`{"anyOf": [{"properties": {"a": {"const": 1}}, "required": ["a"]}, {"properties": {"b": true}}], "unevaluatedProperties": false}`, `{"a": 2, "b": 1}`, false},
+		{`{"anyOf": [{"properties": {"a": {"const": 1}}, "required": ["a"]}, {"properties": {"b": true}}], "unevaluatedProperties": false}`, `{"a": 1, "b": 1}`, true},
+		{`{"prefixItems": [true], "allOf": [{"prefixItems": [true, true]}], "unevaluatedItems": false}`, `[1, 2]`, true},
+		{`{"prefixItems": [true], "allOf": [{"prefixItems": [true, true]}], "unevaluatedItems": false}`, `[1, 2, 3]`, false},
+		{`{"contains": {"const": 1}, "minContains": 2, "maxContains": 3}`, `[1, 2]`, false},
+		{`{"contains": {"const": 1}, "minContains": 2, "maxContains": 3}`, `[1, 1, 1, 1]`, false},
+		{`{"contains": {"const": 1}, "unevaluatedItems": {"type": "string"}}`, `[1, "a"]`, true},
+	}
+
+	for i, c := range cases {
+		schema := `{"$schema": "https://json-schema.org/draft/2020-12/schema",` + c.schema[1:]
+		validator, err := NewValidator([]byte(schema))
+		if err != nil {
+			t.Error(i, "fail on NewValidator with", err)
+			continue
+		}
+
+		if valid, err := validator.IsValid([]byte(c.data)); valid != c.valid || err != nil {
+			t.Error(i, "expected", c.valid, "but got", valid, err)
+		}
+	}
+
+	// anyOf evaluates the subschemas after the succeeded one only for unevaluated*, or the output.
+	count := 0
+	counter := WithKeyword("x-count", func(value interface{}, schema map[string]interface{}) (KeywordValidator, error) {
+		return &testKeyword_count{count: &count}, nil
+	})
+	schemas := []struct {
+		schema string
+		format OutputFormat
+		count  int
+	}{
+		{`{"$schema": "http://json-schema.org/draft-07/schema#", "anyOf": [{}, {"x-count": true}]}`, OutputFormat_Basic, 0},
+		{`{"$schema": "http://json-schema.org/draft-07/schema#", "anyOf": [{}, {"x-count": true}]}`, OutputFormat_Verbose, 1},
+		{`{"$schema": "https://json-schema.org/draft/2020-12/schema", "anyOf": [{}, {"x-count": true}]}`, OutputFormat_Basic, 1},
+	}
+
+	for i, c := range schemas {
+		validator, err := NewValidator([]byte(c.schema), counter, WithOutputFormat(c.format))
+		if err != nil {
+			t.Error(i, "fail on NewValidator with", err)
+			continue
+		}
+
+		count = 0
+		if _, err := validator.Output([]byte(`1`)); err != nil || count != c.count {
+			t.Error(i, "expected", c.count, "evaluations, but got", count, err)
+		}
+	}
+}
+
+func TestDynamicRef(t *testing.T) {
+	// the outermost "$dynamicAnchor" replaces the one of the list.
+	validator, err := NewValidator([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "https://example.com/strings",
+		"$ref": "#/$defs/list",
+		"$defs": {
+			"string": {"$dynamicAnchor": "item", "type": "string"},
+			"list": {
+				"$id": "https://example.com/list",
+				"type": "array",
+				"items": {"$dynamicRef": "#item"},
+				"$defs": {"any": {"$dynamicAnchor": "item"}}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	testValidity(t, validator, []validityCase{{`["a", "b"]`, true}, {`["a", 1]`, false}})
+
+	// "$recursiveRef" follows the outermost "$recursiveAnchor".
+	validator, err = NewValidator([]byte(`{
+		"$schema": "https://json-schema.org/draft/2019-09/schema",
+		"$recursiveAnchor": true,
+		"type": "object",
+		"additionalProperties": {"anyOf": [{"type": "integer"}, {"$recursiveRef": "#"}]}
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	testValidity(t, validator, []validityCase{{`{"a": {"b": 1}}`, true}, {`{"a": {"b": "c"}}`, false}})
+}
+
+func TestDialect(t *testing.T) {
+	// exclusiveMinimum is a boolean in draft4, and a number since draft6.
+	draft4 := []byte(`{"minimum": 1, "exclusiveMinimum": true}`)
+	draft6 := []byte(`{"exclusiveMinimum": 1}`)
+
+	if _, err := NewValidator(draft4); err != nil {
+		t.Error("fail on NewValidator with", err)
+	}
+	if _, err := NewValidator(draft6); !errors.Is(err, ErrInvalidSchemaFormat) {
+		t.Error("expected ErrInvalidSchemaFormat, but got", err)
+	}
+
+	validator, err := NewValidator(draft6, WithDefaultDialect(SchemaType_Draft7))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	testValidity(t, validator, []validityCase{{`1`, false}})
+
+	// "$schema" takes precedence over the default dialect, and the empty fragment is optional.
+	_, err = NewValidator([]byte(`{"$schema": "http://json-schema.org/draft-04/schema", "minimum": 1, "exclusiveMinimum": true}`), WithDefaultDialect(SchemaType_Draft7))
+	if err != nil {
+		t.Error("fail on NewValidator with", err)
+	}
+
+	_, err = NewValidator([]byte(`{"$schema": "http://example.com/unknown"}`))
+	if !errors.Is(err, ErrInvalidSchemaVersion) {
+		t.Error("expected ErrInvalidSchemaVersion, but got", err)
+	}
+	_, err = NewValidator([]byte(`{}`), WithDefaultDialect("http://example.com/unknown"))
+	if !errors.Is(err, ErrInvalidSchemaVersion) {
+		t.Error("expected ErrInvalidSchemaVersion, but got", err)
+	}
+
+	// a custom meta-schema uses the dialect of its own "$schema".
+	meta := []byte(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "$id": "http://example.com/custom"}`)
+	validator, err = NewValidator([]byte(`{"$schema": "http://example.com/custom", "prefixItems": [{"type": "integer"}]}`), WithMetaSchema("http://example.com/custom", meta))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	testValidity(t, validator, []validityCase{{`["a"]`, false}})
+
+	// embedded schema resources may declare another dialect.
+	validator, err = NewValidator([]byte(`{
+		"$schema": "http://json-schema.org/draft-04/schema#",
+		"properties": {
+			"a": {"$schema": "http://json-schema.org/draft-07/schema#", "$id": "http://example.com/a", "exclusiveMinimum": 1}
+		}
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	testValidity(t, validator, []validityCase{{`{"a": 1}`, false}})
+}
+
+func TestDraft3(t *testing.T) {
+	cases := []struct {
+		schema string
+		data   string
+		valid  bool
+	}{
+		{`{"properties": {"a": {"required": true}, "b": {}}}`, `{"a": 1}`, true},
+		{`{"properties": {"a": {"required": true}, "b": {}}}`, `{"b": 1}`, false},
+		{`{"properties": {"a": {"required": false}}}`, `{}`, true},
+		{`{"disallow": "string"}`, `1`, true},
+		{`{"disallow": "string"}`, `"x"`, false},
+		{`{"disallow": ["integer", {"type": "string", "minLength": 2}]}`, `"a"`, true},
+		{`{"disallow": ["integer", {"type": "string", "minLength": 2}]}`, `"ab"`, false},
+		{`{"disallow": ["integer", {"type": "string", "minLength": 2}]}`, `1`, false},
+		{`{"extends": {"minimum": 2}, "maximum": 5}`, `3`, true},
+		{`{"extends": {"minimum": 2}, "maximum": 5}`, `1`, false},
+		{`{"extends": [{"minimum": 2}, {"maximum": 5}]}`, `6`, false},
+		{`{"divisibleBy": 3}`, `9`, true},
+		{`{"divisibleBy": 3}`, `10`, false},
+		{`{"dependencies": {"a": "b"}}`, `{"a": 1, "b": 2}`, true},
+		{`{"dependencies": {"a": "b"}}`, `{"b": 2}`, true},
+		{`{"dependencies": {"a": "b"}}`, `{"a": 1}`, false},
+		{`{"type": ["integer", {"type": "string", "maxLength": 1}]}`, `1`, true},
+		{`{"type": ["integer", {"type": "string", "maxLength": 1}]}`, `"a"`, true},
+		{`{"type": ["integer", {"type": "string", "maxLength": 1}]}`, `"ab"`, false},
+		{`{"type": ["integer", {"type": "string", "maxLength": 1}]}`, `null`, false},
+		{`{"type": "any"}`, `null`, true},
+	}
+
+	for i, c := range cases {
+		schema := `{"$schema": "http://json-schema.org/draft-03/schema#", ` + c.schema[1:]
+		validator, err := NewValidator([]byte(schema))
+		if err != nil {
+			t.Error(i, "fail on NewValidator with", err)
+			continue
+		}
+
+		if valid, err := validator.IsValid([]byte(c.data)); valid != c.valid || err != nil {
+			t.Error(i, "expected", c.valid, "but got", valid, err)
+		}
+	}
+
+	// failures are located at the keywords which they are defined by.
+	locations := []struct {
+		schema   string
+		data     string
+		location string
+	}{
+		{`{"properties": {"a": {"required": true}, "b": {"required": true}}}`, `{"a": 1}`, `"#/properties/b/required"`},
+		{`{"type": {"type": "string", "maxLength": 1}}`, `"ab"`, `"#/type/maxLength"`},
+		{`{"type": ["integer", {"type": "string", "maxLength": 1}]}`, `"ab"`, `"#/type/1/maxLength"`},
+	}
+
+	for i, c := range locations {
+		schema := `{"$schema": "http://json-schema.org/draft-03/schema#", ` + c.schema[1:]
+		validator, err := NewValidator([]byte(schema), WithOutputFormat(OutputFormat_Verbose))
+		if err != nil {
+			t.Error(i, "fail on NewValidator with", err)
+			continue
+		}
+
+		output, err := validator.Output([]byte(c.data))
+		if err != nil || !strings.Contains(string(output), `"keywordLocation":`+c.location) {
+			t.Error(i, "expected", c.location, "in", string(output), err)
+		}
+	}
+
+	// the keywords of draft3 are not allowed in draft4.
+	_, err := NewValidator([]byte(`{"dependencies": {"a": "b"}}`), WithSchemaValidation(false))
+	if !errors.Is(err, ErrInvalidSchemaFormat) {
+		t.Error("expected ErrInvalidSchemaFormat, but got", err)
+	}
+	_, err = NewValidator([]byte(`{"$schema": "http://json-schema.org/draft-03/schema#", "divisibleBy": 0}`))
+	if !errors.Is(err, ErrInvalidSchemaFormat) {
+		t.Error("expected ErrInvalidSchemaFormat, but got", err)
+	}
+}
+
+func TestResolutionScope(t *testing.T) {
+	validator, err := NewValidator([]byte(`{
+		"id": "http://example.com/root.json",
+		"definitions": {
+			"a": {"id": "#foo", "type": "integer"},
+			"b": {
+				"id": "folder/b.json",
+				"definitions": {"c": {"id": "c.json", "type": "string"}},
+				"properties": {"c": {"$ref": "c.json"}}
+			}
+		},
+		"properties": {
+			"a": {"$ref": "#foo"},
+			"b": {"$ref": "folder/b.json"},
+			"c": {"$ref": "http://example.com/folder/c.json"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	testValidity(t, validator, []validityCase{
+		{`{"a": 1, "b": {"c": "x"}, "c": "y"}`, true},
+		{`{"a": "x"}`, false},
+		{`{"b": {"c": 1}}`, false},
+		{`{"c": 1}`, false},
+	})
+}
+
+func TestLoader(t *testing.T) {
+	schema := []byte(`{"properties": {"a": {"$ref": "http://example.com/a.json"}}}`)
+
+	loaders := []Loader{
+		MapLoader{"http://example.com/a.json": []byte(`{"type": "integer"}`)},
+		&FSLoader{
+			FS:   fstest.MapFS{"a.json": &fstest.MapFile{Data: []byte(`{"type": "integer"}`)}},
+			Base: "http://example.com/",
+		},
+	}
+
+	for i, loader := range loaders {
+		validator, err := NewValidator(schema, WithLoader(loader))
+		if err != nil {
+			t.Fatal(i, "fail on NewValidator with", err)
+		}
+		testValidity(t, validator, []validityCase{{`{"a": 1}`, true}, {`{"a": "x"}`, false}})
+	}
+
+	// errors of the loader are reported on compilation.
+	_, err := NewValidator(schema, WithLoader(MapLoader{}))
+	if err == nil || !strings.Contains(err.Error(), "http://example.com/a.json") {
+		t.Error("expected the error of the loader, but got", err)
+	}
+
+	// local files are read only if FileLoader is enabled.
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"type": "integer"}`), 0644)
+	if err != nil {
+		t.Fatal("fail on WriteFile with", err)
+	}
+	uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(dir, "a.json"))}).String()
+	schema = []byte(`{"properties": {"a": {"$ref": "` + uri + `"}}}`)
+
+	_, err = NewValidator(schema)
+	if !errors.Is(err, ErrUnresolvedReference) {
+		t.Error("expected ErrUnresolvedReference, but got", err)
+	}
+
+	validator, err := NewValidator(schema, WithLoader(SchemeLoader{"file": FileLoader{}}))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	testValidity(t, validator, []validityCase{{`{"a": "x"}`, false}})
+}
+
+func TestHTTPLoader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.json":
+			w.Write([]byte(`{"type": "integer"}`))
+		case "/large.json":
+			w.Write([]byte(`{"description": "` + strings.Repeat("x", 100) + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	loader := &HTTPLoader{MaxSize: 64}
+	cases := []struct {
+		uri string
+		ok  bool
+	}{
+		{server.URL + "/a.json", true},
+		{server.URL + "/large.json", false},
+		{server.URL + "/missing.json", false},
+	}
+
+	for _, c := range cases {
+		_, err := loader.Load(c.uri)
+		if (err == nil) != c.ok {
+			t.Error(c.uri, "expected ok", c.ok, "but got", err)
+		}
+	}
+}
+
+func TestRemoteRef(t *testing.T) {
+	loader := MapLoader{
+		"http://example.com/common.json": []byte(`{
+			"definitions": {
+				"address": {
+					"properties": {
+						"street": {"$ref": "#/definitions/street"},
+						"zip": {"$ref": "folder/zip.json#/definitions/zip"}
+					}
+				},
+				"street": {"type": "string"}
+			}
+		}`),
+		"http://example.com/folder/zip.json": []byte(`{
+			"definitions": {"zip": {"type": "string", "pattern": "^[0-9]{3}-[0-9]{4}$"}}
+		}`),
+	}
+
+	validator, err := NewValidator([]byte(`{
+		"properties": {
+			"home": {"$ref": "http://example.com/common.json#/definitions/address"},
+			"office": {"$ref": "http://example.com/common.json#/definitions/address"}
+		}
+	}`), WithLoader(loader))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	testValidity(t, validator, []validityCase{
+		{`{"home": {"street": "a", "zip": "123-4567"}, "office": {"street": "b"}}`, true},
+		{`{"home": {"street": 1}}`, false},
+		{`{"office": {"zip": "1234567"}}`, false},
+	})
+
+	// remote documents are recognized by the dialect of their own "$schema".
+	validator, err = NewValidator([]byte(`{
+		"$schema": "http://json-schema.org/draft-04/schema#",
+		"properties": {
+			"a": {"$ref": "http://example.com/draft7.json"},
+			"b": {"$ref": "http://example.com/draft7.json#/definitions/b"}
+		}
+	}`), WithLoader(MapLoader{
+		"http://example.com/draft7.json": []byte(`{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"exclusiveMinimum": 1,
+			"definitions": {"b": {"exclusiveMaximum": 1}}
+		}`),
+	}))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	testValidity(t, validator, []validityCase{
+		{`{"a": 2, "b": 0}`, true},
+		{`{"a": 1}`, false},
+		{`{"b": 1}`, false},
+	})
+}
+
+func TestRefKeywordLocation(t *testing.T) {
+	loader := MapLoader{
+		"http://example.com/remote.json":  []byte(`{"items": {"$ref": "#/definitions/s"}, "definitions": {"s": {"type": "string"}}}`),
+		"http://example.com/invalid.json": []byte(`{"minimum": "1"}`),
+	}
+
+	validator, err := NewValidator([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"$id": "http://example.com/root.json",
+		"definitions": {
+			"a": {"$id": "#foo", "minimum": 1},
+			"c": {"$id": "c.json", "maximum": 1}
+		},
+		"properties": {
+			"a": {"$ref": "#foo"},
+			"b": {"$ref": "#foo"},
+			"c": {"$ref": "c.json"},
+			"d": {"$ref": "remote.json"}
+		}
+	}`), WithLoader(loader))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	// the keywords of shared schemas are located under the referring "$ref".
+	cases := []struct {
+		data            string
+		keywordLocation string
+	}{
+		{`{"a": 0}`, "#/properties/a/$ref/minimum"},
+		{`{"b": 0}`, "#/properties/b/$ref/minimum"},
+		{`{"c": 2}`, "#/properties/c/$ref/maximum"},
+		{`{"d": [1]}`, "#/properties/d/$ref/items/$ref/type"},
+	}
+
+	for _, c := range cases {
+		verr, ok := validator.Validate([]byte(c.data)).(*ValidationError)
+		if !ok || verr.KeywordLocation != c.keywordLocation {
+			t.Error("expected", c.keywordLocation, "on", c.data, "but got", verr)
+		}
+	}
+
+	_, err = NewValidator([]byte(`{"properties": {"a": {"$ref": "http://example.com/invalid.json"}}}`), WithLoader(loader))
+	var serr *SchemaError
+	if !errors.As(err, &serr) || serr.Pointer != "#/properties/a/$ref/minimum" {
+		t.Error("expected a SchemaError at #/properties/a/$ref/minimum, but got", err)
+	}
+}
+
+func TestResource(t *testing.T) {
+	err := AddResource("https://schemas.example.com/integer.json", []byte(`{"type": "integer"}`))
+	if err != nil {
+		t.Fatal("fail on AddResource with", err)
+	}
+	if err := AddResource("integer.json", []byte(`{}`)); err != ErrInvalidResourceURI {
+		t.Error("expected ErrInvalidResourceURI, but got", err)
+	}
+
+	schema := []byte(`{
+		"properties": {
+			"a": {"$ref": "https://schemas.example.com/integer.json"},
+			"b": {"$ref": "https://schemas.example.com/string.json#/definitions/string"}
+		}
+	}`)
+	validator, err := NewValidator(schema,
+		WithResource("https://schemas.example.com/string.json", []byte(`{"definitions": {"string": {"type": "string"}}}`)),
+		WithLoader(MapLoader{}))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	testValidity(t, validator, []validityCase{
+		{`{"a": 1, "b": "x"}`, true},
+		{`{"a": "x"}`, false},
+		{`{"b": 1}`, false},
+	})
+
+	// invalid resources fail NewValidator like AddResource.
+	_, err = NewValidator(schema, WithResource("string.json", []byte(`{}`)))
+	if !errors.Is(err, ErrInvalidResourceURI) {
+		t.Error("expected ErrInvalidResourceURI, but got", err)
+	}
+	_, err = NewValidator(schema, WithResource("https://schemas.example.com/string.json", []byte(`{`)))
+	if !errors.Is(err, ErrInvalidSchemaFormat) {
+		t.Error("expected ErrInvalidSchemaFormat, but got", err)
+	}
+}
+
+func TestEmbeddedMetaSchema(t *testing.T) {
+	schemaTypes := []SchemaType{
+		SchemaType_Draft4,
+		SchemaType_Draft6,
+		SchemaType_Draft7,
+		SchemaType_Draft2019_09,
+		SchemaType_Draft2020_12,
+	}
+
+	for _, schemaType := range schemaTypes {
+		schema := []byte(`{"$schema": "` + schemaType.String() + `", "$ref": "` + schemaType.String() + `"}`)
+		validator, err := NewValidator(schema, WithLoader(MapLoader{}))
+		if err != nil {
+			t.Error(schemaType, "fail on NewValidator with", err)
+			continue
+		}
+
+		testValidity(t, validator, []validityCase{
+			{`{"type": "string", "properties": {"a": {"minLength": 1}}}`, true},
+			{`{"type": 1}`, false},
+			{`{"properties": {"a": {"minLength": -1}}}`, false},
+		})
+	}
+}
+
+func TestRecursiveRef(t *testing.T) {
+	validator, err := NewValidator([]byte(`{
+		"definitions": {
+			"node": {
+				"type": "object",
+				"properties": {
+					"value": {"type": "integer"},
+					"children": {"type": "array", "items": {"$ref": "#/definitions/node"}},
+					"list": {"$ref": "#/definitions/list"}
+				}
+			},
+			"list": {
+				"type": "object",
+				"properties": {
+					"head": {"$ref": "#/definitions/node"},
+					"tail": {"anyOf": [{"type": "null"}, {"$ref": "#/definitions/list"}]}
+				}
+			}
+		},
+		"$ref": "#/definitions/node"
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	testValidity(t, validator, []validityCase{
+		{`{"value": 1, "children": [{"value": 2, "children": [{"value": 3}]}]}`, true},
+		{`{"value": 1, "children": [{"value": 2, "children": [{"value": "x"}]}]}`, false},
+		{`{"list": {"head": {"value": 1}, "tail": {"head": {"value": 2}, "tail": null}}}`, true},
+		{`{"list": {"head": {"value": 1}, "tail": {"head": {"value": "x"}, "tail": null}}}`, false},
+	})
+
+	// references which never advance in the document stop the validation.
+	validator, err = NewValidator([]byte(`{
+		"definitions": {
+			"a": {"$ref": "#/definitions/b"},
+			"b": {"anyOf": [{"$ref": "#/definitions/a"}]}
+		},
+		"$ref": "#/definitions/a"
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	if valid, err := validator.IsValid([]byte(`1`)); valid || !errors.Is(err, ErrInfiniteRecursion) {
+		t.Error("expected ErrInfiniteRecursion but got", valid, err)
+	}
+
+	// property names are evaluated at the pointer of their object, but they are other instances.
+	validator, err = NewValidator([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": ["object", "string"],
+		"maxLength": 3,
+		"propertyNames": {"$ref": "#"}
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	if valid, err := validator.IsValid([]byte(`{"ab": 1}`)); !valid || err != nil {
+		t.Error("expected valid but got", valid, err)
+	}
+	if valid, err := validator.IsValid([]byte(`{"abcd": 1}`)); valid || err != nil {
+		t.Error("expected invalid but got", valid, err)
+	}
+
+	// deeply nested documents are not limited.
+	validator, err = NewValidator([]byte(`{"items": {"$ref": "#"}, "maxItems": 1}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	const depth = 600
+	deep := func(bottom string) []byte {
+		return []byte(strings.Repeat("[", depth) + bottom + strings.Repeat("]", depth))
+	}
+	if valid, err := validator.IsValid(deep("")); !valid || err != nil {
+		t.Error("expected valid but got", valid, err)
+	}
+	if valid, err := validator.IsValid(deep("1, 2")); valid || err != nil {
+		t.Error("expected invalid but got", valid, err)
+	}
+}
+
+func TestUnresolvedRef(t *testing.T) {
+	cases := []struct {
+		schema   string
+		sentinel error
+	}{
+		{`{"properties": {"a": {"$ref": "#/definitions/missing"}}}`, ErrUnresolvedReference},
+		{`{"properties": {"a": {"$ref": "#missing"}}}`, ErrUnresolvedReference},
+		{`{"properties": {"a": {"$ref": "http://example.com/missing.json"}}}`, ErrUnresolvedReference},
+		{`{"properties": {"a": {"$ref": "http://[::1"}}}`, ErrInvalidReference},
+		{`{"properties": {"a": {"$ref": 1}}}`, ErrInvalidReference},
+	}
+
+	for i, c := range cases {
+		_, err := NewValidator([]byte(c.schema), WithLoader(MapLoader{}))
+		if !errors.Is(err, c.sentinel) {
+			t.Error(i, "expected", c.sentinel, "but got", err)
+			continue
+		}
+		if !strings.Contains(err.Error(), "#/properties/a") {
+			t.Error(i, "expected the location of the reference in", err)
+		}
+	}
+
+	// unresolved references are empty schemas in the lenient mode.
+	validator, err := NewValidator([]byte(cases[0].schema), WithLenientReferences(true))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+	testValidity(t, validator, []validityCase{{`{"a": 1}`, true}})
+	if len(validator.Warnings()) != 1 {
+		t.Error("expected a warning, but got", validator.Warnings())
+	}
+}
+
+func TestEscapedPointerRef(t *testing.T) {
+	validator, err := NewValidator([]byte(`{
+		"definitions": {
+			"tilde~field": {"type": "integer"},
+			"slash/field": {"type": "integer"},
+			"percent%field": {"type": "integer"},
+			"a~1b": {"type": "integer"}
+		},
+		"properties": {
+			"tilde": {"$ref": "#/definitions/tilde~0field"},
+			"slash": {"$ref": "#/definitions/slash~1field"},
+			"percent": {"$ref": "#/definitions/percent%25field"},
+			"escaped": {"$ref": "#/definitions/a~01b"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal("fail on NewValidator with", err)
+	}
+
+	testValidity(t, validator, []validityCase{
+		{`{"tilde": 1, "slash": 1, "percent": 1, "escaped": 1}`, true},
+		{`{"tilde": "x"}`, false},
+		{`{"slash": "x"}`, false},
+		{`{"percent": "x"}`, false},
+		{`{"escaped": "x"}`, false},
+	})
+
+	// array indexes must not have leading zeros.
+	_, err = NewValidator([]byte(`{"items": [{"type": "integer"}], "properties": {"a": {"$ref": "#/items/00"}}}`))
+	if !errors.Is(err, ErrUnresolvedReference) {
+		t.Error("expected ErrUnresolvedReference, but got", err)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	cases := []struct {
+		schema     string
+		violations []string
+	}{
+		{`{"type": "string", "maxLength": 1}`, nil},
+		{`{"maxLength": -1}`, []string{"/maxLength"}},
+		{`{"allOf": [{"minimum": "1"}], "items": 1}`, []string{"/allOf/0/minimum", "/items"}},
+		{`{"$schema": "http://json-schema.org/draft-07/schema#", "if": {"maxLength": -1}}`, []string{"/if/maxLength"}},
+		{`{"$schema": "https://json-schema.org/draft/2020-12/schema", "$defs": {"a": {"minItems": "1"}}}`, []string{"/$defs/a/minItems"}},
+		// embedded schema resources are validated against the meta-schema of their own dialect.
+		{`{"properties": {"a": {"$schema": "http://json-schema.org/draft-07/schema#", "$id": "http://example.com/a", "exclusiveMinimum": true}}}`, []string{"/properties/a/exclusiveMinimum"}},
+	}
+
+	for i, c := range cases {
+		err := ValidateSchema([]byte(c.schema))
+		if c.violations == nil {
+			if err != nil {
+				t.Error(i, "expected valid, but got", err)
+			}
+			continue
+		}
+
+		serr, ok := err.(*InvalidSchemaError)
+		if !ok {
+			t.Error(i, "expected *InvalidSchemaError, but got", err)
+			continue
+		}
+
+		for _, ptr := range c.violations {
+			found := false
+			for _, e := range serr.Errors {
+				found = found || e.Pointer == "#"+ptr
+			}
+			if !found {
+				t.Error(i, "expected a violation at", ptr, "in", serr.Errors)
+			}
+		}
+	}
+
+	// a violation found by several vocabularies is reported once.
+	err := ValidateSchema([]byte(`{"$schema": "https://json-schema.org/draft/2020-12/schema", "properties": {"a": 1}}`))
+	if serr, ok := err.(*InvalidSchemaError); !ok || len(serr.Errors) != 1 {
+		t.Error("expected a violation, but got", err)
+	}
+
+	// NewValidator validates the schema before compilation, even annotations.
+	_, err = NewValidator([]byte(`{"title": 1}`))
+	if !errors.Is(err, ErrInvalidSchemaFormat) {
+		t.Error("expected ErrInvalidSchemaFormat, but got", err)
+	}
+	_, err = NewValidator([]byte(`{"title": 1}`), WithSchemaValidation(false))
+	if err != nil {
+		t.Error("fail on NewValidator with", err)
+	}
+
+	// formats of the meta-schemas are not asserted. (e.g. "uri-reference" of non-ASCII references)
+	for i, schema := range []string{
+		`{"$schema": "http://json-schema.org/draft-07/schema#", "definitions": {"größe": {"type": "integer"}}, "properties": {"a": {"$ref": "#/definitions/größe"}}}`,
+		`{"$schema": "https://json-schema.org/draft/2020-12/schema", "$id": "https://example.com/ä.json", "type": "integer"}`,
+	} {
+		if _, err := NewValidator([]byte(schema)); err != nil {
+			t.Error(i, "fail on NewValidator with", err)
+		}
+	}
+}
+
+func TestSchemaError(t *testing.T) {
+	cases := []struct {
+		schema   string
+		pointer  string
+		keyword  string
+		value    interface{}
+		sentinel error
+	}{
+		{`{"properties": {"a": {"minimum": "1"}}}`, "#/properties/a/minimum", "minimum", "1", ErrInvalidSchemaFormat},
+		{`{"allOf": [{"maxLength": -1}]}`, "#/allOf/0/maxLength", "maxLength", float64(-1), ErrInvalidSchemaFormat},
+		{`{"items": {"type": "unknown"}}`, "#/items/type", "type", "unknown", ErrInvalidTypeName},
+		{`{"properties": {"a": 1}}`, "#/properties/a", "", float64(1), ErrInvalidSchemaFormat},
+		{`{"format": "unknown"}`, "#/format", "format", "unknown", ErrUnknownFormat},
+		{`{"properties": {"a": {"$ref": "#/definitions/missing"}}}`, "#/properties/a/$ref", "$ref", "#/definitions/missing", ErrUnresolvedReference},
+		{`{"properties": {"properties": {"type": ["string", "unknown"]}}}`, "#/properties/properties/type", "type", []interface{}{"string", "unknown"}, ErrInvalidTypeName},
+		{`{"properties": {"a": {"$ref": 1}}}`, "#/properties/a/$ref", "$ref", float64(1), ErrInvalidReference},
+	}
+
+	// violations against the meta-schema are reported as well as failures of compiling.
+	for _, validation := range []bool{false, true} {
+		for i, c := range cases {
+			_, err := NewValidator([]byte(c.schema), WithSchemaValidation(validation), WithUnknownFormatPolicy(UnknownFormatPolicy_Fail))
+			if !errors.Is(err, c.sentinel) {
+				t.Error(i, validation, "expected", c.sentinel, "but got", err)
+			}
+
+			var serr *SchemaError
+			if !errors.As(err, &serr) {
+				t.Error(i, validation, "expected *SchemaError, but got", err)
+				continue
+			}
+			if serr.Pointer != c.pointer || serr.Keyword != c.keyword || !reflect.DeepEqual(serr.Value, c.value) {
+				t.Error(i, validation, "unexpected error:", serr.Pointer, serr.Keyword, serr.Value)
+			}
+		}
+	}
+
+	// violations against the meta-schema also match ErrInvalidSchemaFormat.
+	_, err := NewValidator([]byte(`{"type": "unknown"}`))
+	if !errors.Is(err, ErrInvalidTypeName) || !errors.Is(err, ErrInvalidSchemaFormat) {
+		t.Error("expected ErrInvalidTypeName and ErrInvalidSchemaFormat, but got", err)
+	}
+}
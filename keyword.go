@@ -0,0 +1,144 @@
+package jsonschema
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// KeywordCompiler compiles the value of a custom keyword.
+// schema is the whole schema object which contains the keyword.
+// It may return nil if the keyword needs no validation.
+// Its error is reported by NewValidator as a SchemaError, which matches both ErrInvalidSchemaFormat and the error.
+type KeywordCompiler func(value interface{}, schema map[string]interface{}) (KeywordValidator, error)
+
+// KeywordValidator validates instances against a compiled custom keyword.
+// The instance is failed if Validate reports errors to ctx.
+type KeywordValidator interface {
+	Validate(ctx *KeywordContext, instance interface{})
+}
+
+// KeywordContext is passed to KeywordValidator to report errors of the keyword.
+type KeywordContext struct {
+	ctx      *evalContext
+	ptr      string
+	location string
+	keyword  string
+	failed   bool
+}
+
+// InstanceLocation returns a JSON pointer to the instance under validation.
+func (c *KeywordContext) InstanceLocation() string {
+	return c.ptr
+}
+
+// KeywordLocation returns a JSON pointer to the keyword in the schema.
+func (c *KeywordContext) KeywordLocation() string {
+	return c.ctx.KeywordLocation(c.location)
+}
+
+// AddError reports a failure of the keyword.
+func (c *KeywordContext) AddError(format string, args ...interface{}) {
+	c.failed = true
+	c.ctx.AddError(c.ptr, c.location, c.keyword, format, args...)
+}
+
+// keywordCompilers holds the custom keywords registered to all validators.
+var keywordCompilers = struct {
+	sync.RWMutex
+	compilers map[string]KeywordCompiler
+}{
+	compilers: make(map[string]KeywordCompiler),
+}
+
+// RegisterKeyword registers the compiler of the custom keyword to all validators.
+// Custom keywords are evaluated in addition to the standard keywords, and can not replace them.
+func RegisterKeyword(name string, compiler KeywordCompiler) {
+	keywordCompilers.Lock()
+	defer keywordCompilers.Unlock()
+
+	keywordCompilers.compilers[name] = compiler
+}
+
+// getKeywordCompilers returns the custom keywords in the validator and the registry.
+func getKeywordCompilers(v *Validator) map[string]KeywordCompiler {
+	keywordCompilers.RLock()
+	defer keywordCompilers.RUnlock()
+
+	ret := make(map[string]KeywordCompiler)
+	for name, compiler := range keywordCompilers.compilers {
+		ret[name] = compiler
+	}
+	for name, compiler := range v.keywords {
+		ret[name] = compiler
+	}
+	return ret
+}
+
+type customKeyword struct {
+	name      string
+	location  string
+	validator KeywordValidator
+}
+
+type schemaPropertySub_custom struct {
+	keywords []*customKeyword
+}
+
+func newSubProp_custom(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	compilers := getKeywordCompilers(m.schemaobject.validator)
+	if len(compilers) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0)
+	for name := range compilers {
+		if _, ok := schema[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	s := new(schemaPropertySub_custom)
+	for _, name := range names {
+		validator, err := compilers[name](schema[name], schema)
+		if err != nil {
+			// the error of the compiler is the cause of ErrInvalidSchemaFormat.
+			return nil, newSchemaError(m.KeywordLocation(name), name, schema[name], errors.Join(ErrInvalidSchemaFormat, err), "%v", err)
+		}
+
+		if validator != nil {
+			s.keywords = append(s.keywords, &customKeyword{
+				name:      name,
+				location:  m.KeywordLocation(name),
+				validator: validator,
+			})
+		}
+	}
+
+	if len(s.keywords) == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+func (s *schemaPropertySub_custom) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	valid := true
+	for _, keyword := range s.keywords {
+		kctx := &KeywordContext{
+			ctx:      ctx,
+			ptr:      ptr,
+			location: keyword.location,
+			keyword:  keyword.name,
+		}
+
+		keyword.validator.Validate(kctx, src)
+		if kctx.failed {
+			valid = false
+			if !ctx.ShouldContinue() {
+				return false
+			}
+		}
+	}
+	return valid
+}
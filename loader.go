@@ -0,0 +1,131 @@
+package jsonschema
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Loader loads the raw schema identified by the URI, which has no fragment.
+// It is called to resolve references to schemas out of the schema document,
+// and the returned error is reported by NewValidator with the URI.
+type Loader interface {
+	Load(uri string) ([]byte, error)
+}
+
+const (
+	// DefaultLoaderTimeout is the timeout of HTTPLoader without Client.
+	DefaultLoaderTimeout = 10 * time.Second
+	// DefaultLoaderMaxSize is the size limit of HTTPLoader without MaxSize.
+	DefaultLoaderMaxSize = 10 << 20
+)
+
+// HTTPLoader loads schemas by HTTP and HTTPS.
+type HTTPLoader struct {
+	// Client sends the requests. (a client with DefaultLoaderTimeout if nil)
+	Client *http.Client
+	// MaxSize limits the size of a schema in bytes. (DefaultLoaderMaxSize if 0)
+	MaxSize int64
+}
+
+func (l *HTTPLoader) Load(uri string) ([]byte, error) {
+	client := l.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultLoaderTimeout}
+	}
+
+	maxSize := l.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultLoaderMaxSize
+	}
+
+	resp, err := client.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > maxSize {
+		return nil, fmt.Errorf("exceeds %d bytes", maxSize)
+	}
+	return buf, nil
+}
+
+// FileLoader loads schemas from the local file system by file URIs. (e.g. "file:///path/to/schema.json")
+// It is not a part of DefaultLoader, so that schemas never read local files unless enabled by WithLoader.
+// (e.g. WithLoader(SchemeLoader{"file": FileLoader{}}))
+type FileLoader struct{}
+
+func (l FileLoader) Load(uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" {
+		return nil, errors.New("not a file URI")
+	}
+
+	return os.ReadFile(u.Path)
+}
+
+// FSLoader loads schemas from fs.FS.
+// URIs which start with Base are mapped to the paths after Base. (e.g. "http://example.com/schemas/a.json" to "a.json" with Base "http://example.com/schemas/")
+type FSLoader struct {
+	FS   fs.FS
+	Base string
+}
+
+func (l *FSLoader) Load(uri string) ([]byte, error) {
+	if !strings.HasPrefix(uri, l.Base) {
+		return nil, fmt.Errorf("not under %s", l.Base)
+	}
+
+	return fs.ReadFile(l.FS, strings.TrimPrefix(uri, l.Base))
+}
+
+// MapLoader loads schemas from the map of URIs to raw schemas.
+type MapLoader map[string][]byte
+
+func (l MapLoader) Load(uri string) ([]byte, error) {
+	buf, ok := l[uri]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return buf, nil
+}
+
+// SchemeLoader dispatches URIs to the loaders by their schemes.
+type SchemeLoader map[string]Loader
+
+func (l SchemeLoader) Load(uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	loader, ok := l[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	return loader.Load(uri)
+}
+
+// DefaultLoader loads schemas by HTTP and HTTPS URIs.
+var DefaultLoader Loader = SchemeLoader{
+	"http":  &HTTPLoader{},
+	"https": &HTTPLoader{},
+}
@@ -0,0 +1,109 @@
+package jsonschema
+
+// OutputFormat represents a structure of the validation result.
+// (defined at section 10.4 of JSON Schema Core 2019-09)
+type OutputFormat string
+
+const (
+	// OutputFormat_Flag reports only whether the document is valid.
+	OutputFormat_Flag = OutputFormat("flag")
+	// OutputFormat_Basic reports the failures as a flat list.
+	OutputFormat_Basic = OutputFormat("basic")
+	// OutputFormat_Detailed reports the failures as a tree which follows the structure of the schema.
+	OutputFormat_Detailed = OutputFormat("detailed")
+	// OutputFormat_Verbose reports the results of every evaluated schema, including succeeded ones.
+	OutputFormat_Verbose = OutputFormat("verbose")
+)
+
+// OutputUnit represents a node of the validation result.
+type OutputUnit struct {
+	Valid            bool          `json:"valid"`
+	KeywordLocation  string        `json:"keywordLocation,omitempty"`
+	InstanceLocation string        `json:"instanceLocation"`
+	Error            string        `json:"error,omitempty"`
+	Errors           []*OutputUnit `json:"errors,omitempty"`
+	Annotations      []*OutputUnit `json:"annotations,omitempty"`
+
+	// children holds recorded results of subschemas and keywords.
+	children []*OutputUnit
+}
+
+// newOutput builds the document of the format from the result of a validation.
+// The record is used only for the detailed and verbose formats.
+func newOutput(format OutputFormat, ctx *evalContext, record *OutputUnit) interface{} {
+	valid := len(ctx.errors) == 0
+	switch format {
+	case OutputFormat_Flag:
+		return map[string]bool{"valid": valid}
+
+	case OutputFormat_Detailed:
+		if valid || len(record.children) == 0 {
+			return map[string]bool{"valid": valid}
+		}
+		return record.children[0].detailed()
+
+	case OutputFormat_Verbose:
+		if len(record.children) == 0 {
+			return map[string]bool{"valid": valid}
+		}
+		return record.children[0].verbose()
+	}
+
+	// OutputFormat_Basic, as the other formats are rejected by NewValidator.
+	root := &OutputUnit{
+		Valid:           valid,
+		KeywordLocation: "#",
+		Errors:          make([]*OutputUnit, 0, len(ctx.errors)),
+	}
+	for _, v := range ctx.errors {
+		root.Errors = append(root.Errors, &OutputUnit{
+			Valid:            false,
+			KeywordLocation:  v.KeywordLocation,
+			InstanceLocation: v.InstanceLocation,
+			Error:            v.Message,
+		})
+	}
+	return root
+}
+
+// detailed returns the failed units under the unit, omitting the units which have only one failed child.
+func (u *OutputUnit) detailed() *OutputUnit {
+	ret := &OutputUnit{
+		Valid:            u.Valid,
+		KeywordLocation:  u.KeywordLocation,
+		InstanceLocation: u.InstanceLocation,
+		Error:            u.Error,
+	}
+
+	for _, child := range u.children {
+		if child.Valid {
+			continue
+		}
+
+		detailed := child.detailed()
+		if detailed.Error == "" && len(detailed.Errors) == 1 {
+			detailed = detailed.Errors[0]
+		}
+		ret.Errors = append(ret.Errors, detailed)
+	}
+	return ret
+}
+
+// verbose returns all units under the unit.
+func (u *OutputUnit) verbose() *OutputUnit {
+	ret := &OutputUnit{
+		Valid:            u.Valid,
+		KeywordLocation:  u.KeywordLocation,
+		InstanceLocation: u.InstanceLocation,
+		Error:            u.Error,
+	}
+
+	for _, child := range u.children {
+		if u.Valid {
+			ret.Annotations = append(ret.Annotations, child.verbose())
+		} else {
+			ret.Errors = append(ret.Errors, child.verbose())
+		}
+	}
+	return ret
+}
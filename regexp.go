@@ -0,0 +1,74 @@
+package jsonschema
+
+import (
+	"github.com/dlclark/regexp2"
+	"regexp"
+	"time"
+)
+
+// DefaultRegexpTimeout is the timeout of matching a regular expression without WithRegexpTimeout.
+const DefaultRegexpTimeout = time.Second
+
+// Regexp represents a compiled regular expression of pattern and patternProperties.
+type Regexp interface {
+	// MatchString reports whether s matches the regular expression.
+	// It returns an error if matching is not finished in the timeout.
+	MatchString(s string) (bool, error)
+	String() string
+}
+
+// RegexpEngine compiles regular expressions of pattern and patternProperties.
+// Engines which may backtrack must stop matching after the timeout, which is unlimited if 0.
+type RegexpEngine func(expr string, timeout time.Duration) (Regexp, error)
+
+var (
+	// RegexpEngine_ECMA262 compiles regular expressions in ECMA-262 dialect as JSON Schema requires. (default)
+	// It is a backtracking engine, so that matching may take exponential time until the timeout.
+	RegexpEngine_ECMA262 RegexpEngine = compileECMA262
+	// RegexpEngine_RE2 compiles regular expressions with the regexp package.
+	// It matches in linear time without the timeout, but does not support lookarounds and backreferences.
+	RegexpEngine_RE2 RegexpEngine = compileRE2
+)
+
+type ecma262Regexp struct {
+	re *regexp2.Regexp
+}
+
+func compileECMA262(expr string, timeout time.Duration) (Regexp, error) {
+	re, err := regexp2.Compile(expr, regexp2.ECMAScript)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		re.MatchTimeout = timeout
+	}
+	return &ecma262Regexp{re: re}, nil
+}
+
+func (r *ecma262Regexp) MatchString(s string) (bool, error) {
+	return r.re.MatchString(s)
+}
+
+func (r *ecma262Regexp) String() string {
+	return r.re.String()
+}
+
+type re2Regexp struct {
+	re *regexp.Regexp
+}
+
+func compileRE2(expr string, timeout time.Duration) (Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &re2Regexp{re: re}, nil
+}
+
+func (r *re2Regexp) MatchString(s string) (bool, error) {
+	return r.re.MatchString(s), nil
+}
+
+func (r *re2Regexp) String() string {
+	return r.re.String()
+}
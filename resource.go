@@ -0,0 +1,99 @@
+package jsonschema
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// embeddedMetaSchemas holds the meta-schemas of draft-04 and later, at the paths of their URIs on json-schema.org.
+//
+//go:embed metaschemas
+var embeddedMetaSchemas embed.FS
+
+// resources holds the schema documents registered to all validators.
+var resources = struct {
+	sync.RWMutex
+	schemas map[string][]byte
+}{
+	schemas: make(map[string][]byte),
+}
+
+// AddResource registers the schema document of the absolute URI to all validators.
+// References to the URI are resolved with it, instead of loading it by the loader.
+func AddResource(uri string, schema []byte) error {
+	uri, err := checkResource(uri, schema)
+	if err != nil {
+		return err
+	}
+
+	resources.Lock()
+	defer resources.Unlock()
+
+	resources.schemas[uri] = schema
+	return nil
+}
+
+// checkResource returns the normalized URI of the schema document, or ErrInvalidResourceURI or ErrInvalidSchemaFormat.
+func checkResource(uri string, schema []byte) (string, error) {
+	uri, err := normalizeResourceURI(uri)
+	if err != nil {
+		return "", err
+	}
+
+	if !json.Valid(schema) {
+		return "", ErrInvalidSchemaFormat
+	}
+	return uri, nil
+}
+
+// normalizeResourceURI removes the empty fragment from the URI, which must be absolute.
+func normalizeResourceURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return "", ErrInvalidResourceURI
+	}
+	return strings.TrimSuffix(uri, "#"), nil
+}
+
+// getResource returns the schema document registered to the validator or all validators, or embedded in this package.
+func getResource(uri string, v *Validator) ([]byte, bool) {
+	if buf, ok := v.resources[uri]; ok {
+		return buf, true
+	}
+
+	resources.RLock()
+	buf, ok := resources.schemas[uri]
+	resources.RUnlock()
+	if ok {
+		return buf, true
+	}
+
+	return getEmbeddedMetaSchema(uri)
+}
+
+// getEmbeddedMetaSchema returns the meta-schema of the URI. (e.g. "metaschemas/draft/2020-12/meta/core.json" for "https://json-schema.org/draft/2020-12/meta/core")
+func getEmbeddedMetaSchema(uri string) ([]byte, bool) {
+	var name string
+	switch {
+	case strings.HasPrefix(uri, "http://json-schema.org/"):
+		name = strings.TrimPrefix(uri, "http://json-schema.org/")
+	case strings.HasPrefix(uri, "https://json-schema.org/"):
+		name = strings.TrimPrefix(uri, "https://json-schema.org/")
+	default:
+		return nil, false
+	}
+
+	if !fs.ValidPath(name) {
+		return nil, false
+	}
+
+	buf, err := embeddedMetaSchemas.ReadFile("metaschemas/" + name + ".json")
+	if err != nil {
+		return nil, false
+	}
+	return buf, true
+}
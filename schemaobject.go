@@ -1,36 +1,51 @@
 package jsonschema
 
 import (
-	"regexp"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
 // schemaObject reprecents a jsonschema.
 type schemaObject struct {
 	recognized  *schemaProperty
-	raw         map[string]interface{}
+	raw         interface{}
 	refResolver *refResolver
+
+	// validator holds the options for compilation.
+	validator *Validator
 }
 
-func newSchemaObject(schema map[string]interface{}) (s *schemaObject, err error) {
+func newSchemaObject(schema interface{}, validator *Validator) (s *schemaObject, err error) {
 	s = new(schemaObject)
 	s.raw = schema
+	s.validator = validator
 
-	s.refResolver, err = newRefResolver(schema)
+	d, err := getDialect(schema, validator)
 	if err != nil {
 		return
 	}
 
-	s.recognized, err = s.newSchemaProperty(schema)
+	s.refResolver, err = newRefResolver(schema, d, validator)
+	if err != nil {
+		return
+	}
+
+	s.recognized, err = s.newSchemaProperty(schema, d)
 	if err != nil {
 		return
 	}
 	return
 }
 
-func (s *schemaObject) newSchemaProperty(schema map[string]interface{}) (prop *schemaProperty, err error) {
-	prop = newSchemaProperty(nil, s, "#")
+func (s *schemaObject) newSchemaProperty(schema interface{}, d *dialect) (prop *schemaProperty, err error) {
+	// the base URI of the root is given by its id, or empty if not identified.
+	prop = newSchemaProperty(nil, s, "", "#")
+	prop.dialect = d
+	newSchemaResource(prop)
+	s.refResolver.register("", prop)
 
-	err = prop.Recognize(schema)
+	err = prop.RecognizeSchema(schema)
 	if err != nil {
 		return
 	}
@@ -38,18 +53,48 @@ func (s *schemaObject) newSchemaProperty(schema map[string]interface{}) (prop *s
 	return
 }
 
+// schemaResource represents a schema resource, which is a document or a subschema with "$id".
+// It is the unit of the dynamic scope. (since 2019-09)
+type schemaResource struct {
+	root            *schemaProperty
+	recursiveAnchor bool
+	dynamicAnchors  map[string]*schemaProperty
+}
+
+// newSchemaResource makes the schema the root of a new schema resource.
+func newSchemaResource(root *schemaProperty) *schemaResource {
+	r := &schemaResource{
+		root:           root,
+		dynamicAnchors: make(map[string]*schemaProperty),
+	}
+	root.resource = r
+	root.isResource = true
+	return r
+}
+
 // schemaProperty reprecents a property of jsonschema.
 type schemaProperty struct {
 	mother       *schemaProperty
 	schemaobject *schemaObject
-	original     string
+	base         string
+	location     string
+	dialect      *dialect
+
+	resource      *schemaResource
+	isResource    bool
+	dynamicAnchor string
+
+	// ref is the schema referred by "$ref", which replaces this schema until draft7.
+	ref *schemaProperty
 
 	// properties
 	jsontype []JsonType
+	isFalse  bool
 
 	properties                map[string]*schemaProperty
-	patternProperties         map[string]*schemaProperty
+	patternProperties         []*patternProperty
 	subprop_list              []schemaPropertySub
+	late_list                 []schemaPropertySub
 	additionalProperties      *schemaProperty
 	allowAdditionalProperties bool
 
@@ -57,36 +102,77 @@ type schemaProperty struct {
 	items                []*schemaProperty
 	additionalItems      *schemaProperty
 	allowAdditionalItems bool
+}
 
-	// validation
-	checked []string
+// patternProperty represents a subschema of patternProperties with its compiled pattern.
+type patternProperty struct {
+	regexp Regexp
+	schema *schemaProperty
 }
 
-func newSchemaProperty(mother *schemaProperty, schema *schemaObject, original string) *schemaProperty {
+func newSchemaProperty(mother *schemaProperty, schema *schemaObject, base, location string) *schemaProperty {
 	return &schemaProperty{
 		jsontype:                  make([]JsonType, 0),
 		properties:                make(map[string]*schemaProperty),
-		patternProperties:         make(map[string]*schemaProperty),
+		patternProperties:         make([]*patternProperty, 0),
 		items:                     make([]*schemaProperty, 0),
 		mother:                    mother,
 		schemaobject:              schema,
-		original:                  original,
+		base:                      base,
+		location:                  location,
 		allowAdditionalProperties: true,
 		allowAdditionalItems:      true,
 		subprop_list:              make([]schemaPropertySub, 0),
+		late_list:                 make([]schemaPropertySub, 0),
 	}
 }
 
-func (s *schemaProperty) NewChild() *schemaProperty {
-	return newSchemaProperty(s, s.schemaobject, s.original)
+// NewChild returns a subschema placed at the given tokens under this schema.
+func (s *schemaProperty) NewChild(tokens ...string) *schemaProperty {
+	news := newSchemaProperty(s, s.schemaobject, s.base, s.KeywordLocation(tokens...))
+	news.dialect = s.dialect
+	news.resource = s.resource
+	return news
 }
 
-func (s *schemaProperty) NewBrother() *schemaProperty {
-	return newSchemaProperty(s.mother, s.schemaobject, s.original)
+// NewBrother returns a subschema which applies to the same instance as this schema.
+func (s *schemaProperty) NewBrother(tokens ...string) *schemaProperty {
+	news := newSchemaProperty(s.mother, s.schemaobject, s.base, s.KeywordLocation(tokens...))
+	news.dialect = s.dialect
+	news.resource = s.resource
+	return news
+}
+
+// KeywordLocation returns a JSON pointer to the given tokens under this schema.
+func (s *schemaProperty) KeywordLocation(tokens ...string) string {
+	location := s.location
+	for _, token := range tokens {
+		location = location + "/" + escapeJsonPointer(token)
+	}
+	return location
+}
+
+// RecognizeSchema recognizes a schema, which may be a boolean since draft6.
+func (s *schemaProperty) RecognizeSchema(schema interface{}) error {
+	switch obj := schema.(type) {
+	case map[string]interface{}:
+		return s.Recognize(obj)
+	case bool:
+		if s.dialect.booleanSchema {
+			s.jsontype = append(s.jsontype, JsonType_Any)
+			s.isFalse = !obj
+			return nil
+		}
+	}
+
+	return newSchemaError(s.location, "", schema, ErrInvalidSchemaFormat, "must be a schema, but got %s", getJsonTypeOf(schema))
 }
 
 func (s *schemaProperty) Recognize(schema map[string]interface{}) error {
 	fnlist := []func(map[string]interface{}) error{
+		s.SetDialect,
+		s.SetBase,
+		s.SetResource,
 		s.SetRef,
 		s.SetJsonTypes,
 		s.SetPatternProperties,
@@ -95,6 +181,7 @@ func (s *schemaProperty) Recognize(schema map[string]interface{}) error {
 		s.SetAdditionalItems,
 		s.SetSubProperties,
 		s.SetProperties,
+		s.SetDefinitions,
 	}
 
 	for _, fn := range fnlist {
@@ -109,29 +196,124 @@ func (s *schemaProperty) Recognize(schema map[string]interface{}) error {
 	return nil
 }
 
+// SetDialect switches the dialect by "$schema" of an embedded schema resource.
+// "$schema" is ignored in subschemas which are not schema resources.
+func (s *schemaProperty) SetDialect(schema map[string]interface{}) error {
+	raw, ok := schema["$schema"]
+	if !ok {
+		return nil
+	}
+
+	uri, ok := raw.(string)
+	if !ok {
+		return newSchemaError(s.KeywordLocation("$schema"), "$schema", raw, ErrInvalidSchemaVersion, "must be a string, but got %s", getJsonTypeOf(raw))
+	}
+
+	d, err := findDialect(uri, s.schemaobject.validator)
+	if err != nil {
+		return newSchemaError(s.KeywordLocation("$schema"), "$schema", raw, err, "unknown dialect %q", uri)
+	}
+
+	if id, ok := schema[d.idKeyword].(string); ok && !strings.HasPrefix(id, "#") {
+		s.dialect = d
+	}
+	return nil
+}
+
+// SetBase changes the base URI of the schema and its subschemas by its id.
+func (s *schemaProperty) SetBase(schema map[string]interface{}) error {
+	id, ok := schemaId(schema, s.dialect)
+	if !ok {
+		return nil
+	}
+
+	uri, err := resolveURI(s.base, id)
+	if err != nil {
+		return newSchemaError(s.KeywordLocation(s.dialect.idKeyword), s.dialect.idKeyword, id, ErrInvalidSchemaFormat, "invalid URI: %v", err)
+	}
+
+	var fragment string
+	s.base, fragment = splitFragment(uri)
+	if fragment == "" {
+		s.schemaobject.refResolver.register(s.base, s)
+	} else if !strings.HasPrefix(fragment, "/") {
+		// a plain name fragment in id until draft7.
+		s.schemaobject.refResolver.register(uri, s)
+	}
+	return nil
+}
+
+// SetResource registers the anchors of the schema to its schema resource. (since 2019-09)
+func (s *schemaProperty) SetResource(schema map[string]interface{}) error {
+	if s.dialect.anchorKeywords == nil {
+		return nil
+	}
+
+	if id, ok := schema[s.dialect.idKeyword].(string); ok && !s.isResource && !strings.HasPrefix(id, "#") {
+		newSchemaResource(s)
+	}
+
+	if v, ok := schema["$anchor"].(string); ok {
+		s.schemaobject.refResolver.register(s.base+"#"+v, s)
+	}
+
+	if v, ok := schema["$recursiveAnchor"]; ok && s.dialect.schemaType == SchemaType_Draft2019_09 {
+		anchor, ok := v.(bool)
+		if !ok {
+			return newSchemaError(s.KeywordLocation("$recursiveAnchor"), "$recursiveAnchor", v, ErrInvalidSchemaFormat, "must be a boolean, but got %s", getJsonTypeOf(v))
+		}
+
+		// "$recursiveAnchor" is meaningful only at the root of a schema resource.
+		if s.isResource {
+			s.resource.recursiveAnchor = anchor
+		}
+	}
+
+	if v, ok := schema["$dynamicAnchor"]; ok && s.dialect.schemaType == SchemaType_Draft2020_12 {
+		anchor, ok := v.(string)
+		if !ok {
+			return newSchemaError(s.KeywordLocation("$dynamicAnchor"), "$dynamicAnchor", v, ErrInvalidSchemaFormat, "must be a string, but got %s", getJsonTypeOf(v))
+		}
+
+		s.dynamicAnchor = anchor
+		s.schemaobject.refResolver.register(s.base+"#"+anchor, s)
+		if _, ok := s.resource.dynamicAnchors[anchor]; !ok {
+			s.resource.dynamicAnchors[anchor] = s
+		}
+	}
+
+	return nil
+}
+
+// SetDefinitions recognizes "$defs" to register their anchors, though they are evaluated only by references. (since 2019-09)
+func (s *schemaProperty) SetDefinitions(schema map[string]interface{}) error {
+	if s.dialect.anchorKeywords == nil {
+		return nil
+	}
+
+	obj, ok := schema["$defs"]
+	if !ok {
+		return nil
+	}
+
+	obj2, ok := obj.(map[string]interface{})
+	if !ok {
+		return newSchemaError(s.KeywordLocation("$defs"), "$defs", obj, ErrInvalidSchemaFormat, "must be an object, but got %s", getJsonTypeOf(obj))
+	}
+
+	for _, k := range sortedKeys(obj2) {
+		news := s.NewChild("$defs", k)
+		err := news.RecognizeSchema(obj2[k])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *schemaProperty) SetSubProperties(schema map[string]interface{}) error {
-	creater_list := []func(map[string]interface{}, *schemaProperty) (schemaPropertySub, error){
-		newSubProp_maxProperties,
-		newSubProp_minProperties,
-		newSubProp_maximum,
-		newSubProp_minimum,
-		newSubProp_maxLength,
-		newSubProp_minLength,
-		newSubProp_maxItems,
-		newSubProp_minItems,
-		newSubProp_pattern,
-		newSubProp_uniqueItem,
-		newSubProp_required,
-		newSubProp_dependency,
-		newSubProp_enum,
-		newSubProp_allOf,
-		newSubProp_anyOf,
-		newSubProp_oneOf,
-		newSubProp_not,
-		newSubProp_multipleOf,
-	}
-
-	for _, fn := range creater_list {
+	for _, fn := range s.dialect.creaters {
 		obj, err := fn(schema, s)
 		if err != nil {
 			return err
@@ -142,31 +324,45 @@ func (s *schemaProperty) SetSubProperties(schema map[string]interface{}) error {
 		}
 	}
 
+	for _, fn := range s.dialect.lateCreaters {
+		obj, err := fn(schema, s)
+		if err != nil {
+			return err
+		}
+
+		if obj != nil {
+			s.late_list = append(s.late_list, obj)
+		}
+	}
+
 	return nil
 }
 
 func (s *schemaProperty) SetRef(schema map[string]interface{}) error {
 	v, ok := schema["$ref"]
-	if !ok {
+	if !ok || s.dialect.refApplicator {
+		// "$ref" with its siblings is set by newSubProp_ref.
 		return nil
 	}
 
-	if path, ok := v.(string); ok {
-		news := s.NewBrother()
-		err := s.schemaobject.refResolver.GetReferencedObject(path, news)
-		if err != nil {
-			return err
-		}
-		*s = *news
+	path, ok := v.(string)
+	if !ok {
+		return newSchemaError(s.KeywordLocation("$ref"), "$ref", v, ErrInvalidReference, "must be a string, but got %s", getJsonTypeOf(v))
+	}
 
-		return errFoundReference
+	ref, err := s.schemaobject.refResolver.GetReferencedObject(path, s.KeywordLocation("$ref"), s)
+	if err != nil {
+		return err
 	}
-	return nil
+	s.ref = ref
+
+	return errFoundReference
 }
 
 func (s *schemaProperty) SetJsonTypes(schema map[string]interface{}) error {
 	v, ok := schema["type"]
-	if !ok {
+	if !ok || s.dialect.schemaType == SchemaType_Draft3 {
+		// type of draft3 may contain schemas, and validated by schemaPropertySub_type3.
 		s.jsontype = append(s.jsontype, JsonType_Any)
 		return nil
 	}
@@ -175,7 +371,7 @@ func (s *schemaProperty) SetJsonTypes(schema map[string]interface{}) error {
 	case string:
 		type_raw, err := GetJsonType(typename)
 		if err != nil {
-			return err
+			return newSchemaError(s.KeywordLocation("type"), "type", v, err, "unknown type %q", typename)
 		}
 
 		s.jsontype = append(s.jsontype, type_raw)
@@ -184,18 +380,18 @@ func (s *schemaProperty) SetJsonTypes(schema map[string]interface{}) error {
 		for _, obj := range typename {
 			str, ok := obj.(string)
 			if !ok {
-				return ErrInvalidSchemaFormat
+				return newSchemaError(s.KeywordLocation("type"), "type", v, ErrInvalidSchemaFormat, "must be an array of strings")
 			}
 
 			type_raw, err := GetJsonType(str)
 			if err != nil {
-				return err
+				return newSchemaError(s.KeywordLocation("type"), "type", v, err, "unknown type %q", str)
 			}
 
 			s.jsontype = append(s.jsontype, type_raw)
 		}
 	default:
-		return ErrInvalidSchemaFormat
+		return newSchemaError(s.KeywordLocation("type"), "type", v, ErrInvalidSchemaFormat, "must be a string or an array, but got %s", getJsonTypeOf(v))
 	}
 
 	return nil
@@ -209,17 +405,12 @@ func (s *schemaProperty) SetProperties(schema map[string]interface{}) error {
 
 	obj2, ok := obj.(map[string]interface{})
 	if !ok {
-		return ErrInvalidSchemaFormat
+		return newSchemaError(s.KeywordLocation("properties"), "properties", obj, ErrInvalidSchemaFormat, "must be an object, but got %s", getJsonTypeOf(obj))
 	}
 
-	for k, v := range obj2 {
-		obj3, ok := v.(map[string]interface{})
-		if !ok {
-			return ErrInvalidSchemaFormat
-		}
-
-		news := s.NewChild()
-		err := news.Recognize(obj3)
+	for _, k := range sortedKeys(obj2) {
+		news := s.NewChild("properties", k)
+		err := news.RecognizeSchema(obj2[k])
 		if err != nil {
 			return err
 		}
@@ -238,50 +429,76 @@ func (s *schemaProperty) SetPatternProperties(schema map[string]interface{}) err
 
 	obj2, ok := obj.(map[string]interface{})
 	if !ok {
-		return ErrInvalidSchemaFormat
+		return newSchemaError(s.KeywordLocation("patternProperties"), "patternProperties", obj, ErrInvalidSchemaFormat, "must be an object, but got %s", getJsonTypeOf(obj))
 	}
 
-	for k, v := range obj2 {
-		obj3, ok := v.(map[string]interface{})
-		if !ok {
-			return ErrInvalidSchemaFormat
+	// sorted to evaluate the patterns in a stable order.
+	for _, k := range sortedKeys(obj2) {
+		v := s.schemaobject.validator
+		re, err := v.regexpEngine(k, v.regexpTimeout)
+		if err != nil {
+			return newSchemaError(s.KeywordLocation("patternProperties", k), "patternProperties", k, ErrInvalidSchemaFormat, "invalid regular expression: %v", err)
 		}
 
-		news := s.NewChild()
-		err := news.Recognize(obj3)
+		news := s.NewChild("patternProperties", k)
+		err = news.RecognizeSchema(obj2[k])
 		if err != nil {
 			return err
 		}
 
-		s.patternProperties[k] = news
+		s.patternProperties = append(s.patternProperties, &patternProperty{
+			regexp: re,
+			schema: news,
+		})
 	}
 
 	return nil
 }
 
 func (s *schemaProperty) SetItems(schema map[string]interface{}) error {
+	if s.dialect.prefixItems {
+		return s.SetPrefixItems(schema)
+	}
+
 	obj, ok := schema["items"]
 	if !ok {
 		return nil
 	}
-	if obj2, ok := obj.(map[string]interface{}); ok {
-		news := s.NewChild()
-		err := news.Recognize(obj2)
+	if obj2, ok := obj.([]interface{}); ok {
+		for i, obj3 := range obj2 {
+			news := s.NewChild("items", strconv.Itoa(i))
+			err := news.RecognizeSchema(obj3)
+			if err != nil {
+				return err
+			}
+
+			s.items = append(s.items, news)
+		}
+	} else {
+		news := s.NewChild("items")
+		err := news.RecognizeSchema(obj)
 		if err != nil {
 			return err
 		}
 
 		s.isItemsOne = true
 		s.items = append(s.items, news)
-	} else if obj2, ok := obj.([]interface{}); ok {
-		for _, obj3 := range obj2 {
-			obj4, ok := obj3.(map[string]interface{})
-			if !ok {
-				return ErrInvalidSchemaFormat
-			}
+	}
+
+	return nil
+}
+
+// SetPrefixItems sets "prefixItems" as the tuple, and "items" as the schema of the rest of the items. (since 2020-12)
+func (s *schemaProperty) SetPrefixItems(schema map[string]interface{}) error {
+	if obj, ok := schema["prefixItems"]; ok {
+		obj2, ok := obj.([]interface{})
+		if !ok {
+			return newSchemaError(s.KeywordLocation("prefixItems"), "prefixItems", obj, ErrInvalidSchemaFormat, "must be an array, but got %s", getJsonTypeOf(obj))
+		}
 
-			news := s.NewChild()
-			err := news.Recognize(obj4)
+		for i, obj3 := range obj2 {
+			news := s.NewChild("prefixItems", strconv.Itoa(i))
+			err := news.RecognizeSchema(obj3)
 			if err != nil {
 				return err
 			}
@@ -290,6 +507,26 @@ func (s *schemaProperty) SetItems(schema map[string]interface{}) error {
 		}
 	}
 
+	obj, ok := schema["items"]
+	if !ok {
+		return nil
+	}
+
+	news := s.NewChild("items")
+	err := news.RecognizeSchema(obj)
+	if err != nil {
+		return err
+	}
+
+	if len(s.items) == 0 {
+		s.isItemsOne = true
+		s.items = append(s.items, news)
+	} else if news.isFalse {
+		s.allowAdditionalItems = false
+	} else {
+		s.additionalItems = news
+	}
+
 	return nil
 }
 
@@ -301,7 +538,7 @@ func (s *schemaProperty) SetAdditionalProperties(schema map[string]interface{})
 
 	switch prop := obj.(type) {
 	case map[string]interface{}:
-		news := s.NewChild()
+		news := s.NewChild("additionalProperties")
 		err := news.Recognize(prop)
 		if err != nil {
 			return err
@@ -310,6 +547,12 @@ func (s *schemaProperty) SetAdditionalProperties(schema map[string]interface{})
 		s.additionalProperties = news
 
 	case bool:
+		if prop && s.dialect.booleanSchema {
+			// true is a schema which evaluates the additional properties.
+			news := s.NewChild("additionalProperties")
+			news.RecognizeSchema(prop)
+			s.additionalProperties = news
+		}
 		s.allowAdditionalProperties = prop
 	}
 
@@ -318,13 +561,14 @@ func (s *schemaProperty) SetAdditionalProperties(schema map[string]interface{})
 
 func (s *schemaProperty) SetAdditionalItems(schema map[string]interface{}) error {
 	obj, ok := schema["additionalItems"]
-	if !ok {
+	if !ok || s.dialect.prefixItems {
+		// "additionalItems" is replaced by "items" since 2020-12.
 		return nil
 	}
 
 	switch prop := obj.(type) {
 	case map[string]interface{}:
-		news := s.NewChild()
+		news := s.NewChild("additionalItems")
 		err := news.Recognize(prop)
 		if err != nil {
 			return err
@@ -333,6 +577,12 @@ func (s *schemaProperty) SetAdditionalItems(schema map[string]interface{}) error
 		s.additionalItems = news
 
 	case bool:
+		if prop && s.dialect.booleanSchema {
+			// true is a schema which evaluates the additional items.
+			news := s.NewChild("additionalItems")
+			news.RecognizeSchema(prop)
+			s.additionalItems = news
+		}
 		s.allowAdditionalItems = prop
 	}
 
@@ -340,14 +590,23 @@ func (s *schemaProperty) SetAdditionalItems(schema map[string]interface{}) error
 }
 
 // ==validators
-func (s *schemaObject) IsValid(src interface{}) bool {
-	return s.recognized.IsValid(src)
+func (s *schemaObject) Validate(ctx *evalContext, src interface{}) error {
+	s.recognized.Validate(ctx, src, "")
+	return ctx.Err()
 }
 
-func (p *schemaProperty) IsValid(src interface{}) bool {
-	p.checked = make([]string, 0)
+func (p *schemaProperty) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	if ctx.Aborted() != nil {
+		return false
+	}
 
-	fnlist := []func(interface{}) bool{
+	ctx.EnterSchema(p.location, ptr)
+	if p.isResource {
+		ctx.EnterResource(p.resource)
+	}
+
+	fnlist := []func(*evalContext, interface{}, string) bool{
+		p.IsBooleanValid,
 		p.IsTypeValid,
 		p.IsItemsValid,
 		p.IsPatternPropertiesValid,
@@ -357,121 +616,188 @@ func (p *schemaProperty) IsValid(src interface{}) bool {
 		p.IsPropertiesValid,
 		p.IsAdditionalPropertyValid,
 		p.IsAdditionalItemsValid,
+		p.IsLateSubPropertiesValid,
+	}
+	if p.ref != nil {
+		fnlist = []func(*evalContext, interface{}, string) bool{
+			p.IsRefValid,
+		}
 	}
 
+	valid := true
 	for _, fn := range fnlist {
-		if !fn(src) {
-			return false
+		if !fn(ctx, src, ptr) {
+			valid = false
+			if !ctx.ShouldContinue() {
+				break
+			}
 		}
 	}
 
-	return true
+	if p.isResource {
+		ctx.LeaveResource()
+	}
+	ctx.LeaveSchema(valid)
+	return valid
+}
+
+// IsRefValid evaluates the schema referred by "$ref" instead of this schema.
+func (p *schemaProperty) IsRefValid(ctx *evalContext, src interface{}, ptr string) bool {
+	if !ctx.EnterRef(p.KeywordLocation("$ref"), p.ref, src, ptr) {
+		return false
+	}
+	valid := p.ref.Validate(ctx, src, ptr)
+	ctx.LeaveRef()
+	return valid
 }
 
-func (p *schemaProperty) IsSubPropertiesValid(src interface{}) bool {
+// IsLateSubPropertiesValid evaluates the keywords which depend on the annotations of the other keywords.
+func (p *schemaProperty) IsLateSubPropertiesValid(ctx *evalContext, src interface{}, ptr string) bool {
+	valid := true
+	for _, obj := range p.late_list {
+		if !obj.Validate(ctx, src, ptr) {
+			valid = false
+			if !ctx.ShouldContinue() {
+				break
+			}
+		}
+	}
+	return valid
+}
+
+func (p *schemaProperty) IsSubPropertiesValid(ctx *evalContext, src interface{}, ptr string) bool {
+	valid := true
 	for _, obj := range p.subprop_list {
-		valid := obj.IsValid(src)
-		if !valid {
-			return false
+		if !obj.Validate(ctx, src, ptr) {
+			valid = false
+			if !ctx.ShouldContinue() {
+				break
+			}
 		}
 	}
+	return valid
+}
+
+func (p *schemaProperty) IsBooleanValid(ctx *evalContext, src interface{}, ptr string) bool {
+	if p.isFalse {
+		ctx.AddError(ptr, p.location, "", "no value is allowed by false schema")
+		return false
+	}
 	return true
 }
 
-func (p *schemaProperty) IsTypeValid(src interface{}) bool {
+func (p *schemaProperty) IsTypeValid(ctx *evalContext, src interface{}, ptr string) bool {
 	for _, v := range p.jsontype {
 		if v.IsMatched(src) {
 			return true
 		}
 	}
 
+	ctx.AddError(ptr, p.KeywordLocation("type"), "type", "expected %v, but got %s", p.jsontype, getJsonTypeOf(src))
 	return false
 }
 
 //--
-func (p *schemaProperty) IsPropertiesValid(src interface{}) bool {
+func (p *schemaProperty) IsPropertiesValid(ctx *evalContext, src interface{}, ptr string) bool {
 	obj, ok := src.(map[string]interface{})
 	if !ok {
 		return true
 	}
 
-	for k, v := range p.properties {
-		if prop, ok := obj[k]; ok {
-			res := v.IsValid(prop)
-			p.checked = append(p.checked, k)
+	valid := true
+	for _, k := range sortedKeys(obj) {
+		if v, ok := p.properties[k]; ok {
+			res := v.Validate(ctx, obj[k], ptr+"/"+escapeJsonPointer(k))
+			ctx.MarkEvaluated(k)
 			if !res {
-				return false
+				valid = false
+				if !ctx.ShouldContinue() {
+					return false
+				}
 			}
 		}
 	}
 
-	return true
+	return valid
 }
 
-func (p *schemaProperty) IsItemsValid(src interface{}) bool {
+func (p *schemaProperty) IsItemsValid(ctx *evalContext, src interface{}, ptr string) bool {
 	if len(p.items) == 0 {
 		return true
 	}
 
+	valid := true
 	if obj, ok := src.([]interface{}); ok {
-		if !p.isItemsOne {
-			for i := 0; i < len(obj); i++ {
+		for i := 0; i < len(obj); i++ {
+			item := p.items[0]
+			if !p.isItemsOne {
 				if len(p.items) <= i {
 					break
 				}
-				if !p.items[i].IsValid(obj[i]) {
-					return false
-				}
+				item = p.items[i]
 			}
-		} else {
-			for _, v := range obj {
-				if !p.items[0].IsValid(v) {
+
+			res := item.Validate(ctx, obj[i], ptr+"/"+strconv.Itoa(i))
+			ctx.AnnotateItem(i)
+			if !res {
+				valid = false
+				if !ctx.ShouldContinue() {
 					return false
 				}
 			}
 		}
 	}
 
-	return true
+	return valid
 }
 
-func (p *schemaProperty) IsPatternPropertiesValid(src interface{}) bool {
+func (p *schemaProperty) IsPatternPropertiesValid(ctx *evalContext, src interface{}, ptr string) bool {
 	obj, ok := src.(map[string]interface{})
 	if !ok {
 		return true
 	}
 
-	for pat, child := range p.patternProperties {
-		re, err := regexp.Compile(pat)
-		if err != nil {
-			return false
-		}
+	valid := true
+	names := sortedKeys(obj)
+	for _, child := range p.patternProperties {
+		for _, k := range names {
+			matched, err := child.regexp.MatchString(k)
+			if err != nil {
+				ctx.Abort(fmt.Errorf("%w at '%s' (%s): %v", ErrRegexpTimeout, ptr, child.schema.location, err))
+				return false
+			}
 
-		for k, v := range obj {
-			if re.MatchString(k) {
-				res := child.IsValid(v)
-				p.checked = append(p.checked, k)
+			if matched {
+				res := child.schema.Validate(ctx, obj[k], ptr+"/"+escapeJsonPointer(k))
+				ctx.MarkEvaluated(k)
 				if !res {
-					return false
+					valid = false
+					if !ctx.ShouldContinue() {
+						return false
+					}
 				}
 			}
 		}
 	}
 
-	return true
+	return valid
 }
 
-func (p *schemaProperty) IsAdditionalPropertyValid(src interface{}) bool {
+func (p *schemaProperty) IsAdditionalPropertyValid(ctx *evalContext, src interface{}, ptr string) bool {
+	obj, ok := src.(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	names := sortedKeys(obj)
+
+	valid := true
 	if !p.allowAdditionalProperties {
-		if obj, ok := src.(map[string]interface{}); ok {
-			for k, _ := range obj {
-				matched := false
-				for _, checked := range p.checked {
-					if checked == k {
-						matched = true
-					}
-				}
-				if !matched {
+		for _, k := range names {
+			if !ctx.IsEvaluated(k) {
+				ctx.AddError(ptr, p.KeywordLocation("additionalProperties"), "additionalProperties", "additional property %q is not allowed", k)
+				valid = false
+				if !ctx.ShouldContinue() {
 					return false
 				}
 			}
@@ -479,30 +805,26 @@ func (p *schemaProperty) IsAdditionalPropertyValid(src interface{}) bool {
 	}
 
 	if p.additionalProperties == nil {
-		return true
+		return valid
 	}
 
-	if obj, ok := src.(map[string]interface{}); ok {
-		for k, v := range obj {
-			matched := false
-			for _, checked := range p.checked {
-				if checked == k {
-					matched = true
-				}
-			}
-			if !matched {
-				res := p.additionalProperties.IsValid(v)
-				if !res {
+	for _, k := range names {
+		if !ctx.IsEvaluated(k) {
+			res := p.additionalProperties.Validate(ctx, obj[k], ptr+"/"+escapeJsonPointer(k))
+			ctx.AnnotateProperty(k)
+			if !res {
+				valid = false
+				if !ctx.ShouldContinue() {
 					return false
 				}
 			}
 		}
 	}
 
-	return true
+	return valid
 }
 
-func (s *schemaProperty) IsAdditionalItemsValid(src interface{}) bool {
+func (s *schemaProperty) IsAdditionalItemsValid(ctx *evalContext, src interface{}, ptr string) bool {
 	if len(s.items) == 0 {
 		return true
 	}
@@ -515,19 +837,35 @@ func (s *schemaProperty) IsAdditionalItemsValid(src interface{}) bool {
 		return true
 	}
 
+	valid := true
 	if obj, ok := src.([]interface{}); ok {
 		if !s.allowAdditionalItems {
 			if len(obj) > len(s.items) {
+				keyword := s.additionalItemsKeyword()
+				ctx.AddError(ptr, s.KeywordLocation(keyword), keyword, "expected at most %d items, but got %d", len(s.items), len(obj))
 				return false
 			}
 		} else {
-			for i := len(s.items) + 1; i < len(obj); i++ {
-				if !s.additionalItems.IsValid(obj[i]) {
-					return false
+			for i := len(s.items); i < len(obj); i++ {
+				res := s.additionalItems.Validate(ctx, obj[i], ptr+"/"+strconv.Itoa(i))
+				ctx.AnnotateItem(i)
+				if !res {
+					valid = false
+					if !ctx.ShouldContinue() {
+						return false
+					}
 				}
 			}
 		}
 	}
 
-	return true
+	return valid
+}
+
+// additionalItemsKeyword returns the keyword which applies to the items after the tuple.
+func (s *schemaProperty) additionalItemsKeyword() string {
+	if s.dialect.prefixItems {
+		return "items"
+	}
+	return "additionalItems"
 }
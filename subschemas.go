@@ -1,17 +1,21 @@
 package jsonschema
 
 import (
+	"fmt"
 	"math"
 	"reflect"
-	"regexp"
+	"sort"
+	"strconv"
 )
 
 type schemaPropertySub interface {
-	IsValid(interface{}) bool
+	Validate(ctx *evalContext, src interface{}, ptr string) bool
 }
 
 // defined at 5.1.3.(@Validation)
 type schemaPropertySub_minimum struct {
+	location         string
+	keyword          string
 	minimum          float64
 	exclusiveMinimum bool
 }
@@ -23,26 +27,28 @@ func newSubProp_minimum(schema map[string]interface{}, m *schemaProperty) (schem
 	if !min_exist {
 		if excMin_exist {
 			// If "exclusiveMaximum" is present, "maximum" MUST also be present.
-			return nil, ErrInvalidSchemaFormat
+			return nil, newSchemaError(m.KeywordLocation("exclusiveMinimum"), "exclusiveMinimum", excMin_raw, ErrInvalidSchemaFormat, "requires \"minimum\"")
 		} else {
 			return nil, nil
 		}
 	}
 
 	s := new(schemaPropertySub_minimum)
+	s.location = m.KeywordLocation("minimum")
+	s.keyword = "minimum"
 
 	ok := false
 	s.minimum, ok = min_raw.(float64)
 	if !ok {
 		// must JSON number.
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("minimum"), "minimum", min_raw, ErrInvalidSchemaFormat, "must be a number, but got %s", getJsonTypeOf(min_raw))
 	}
 
 	if excMin_exist {
 		s.exclusiveMinimum, ok = excMin_raw.(bool)
 		if !ok {
 			// must boolean.
-			return nil, ErrInvalidSchemaFormat
+			return nil, newSchemaError(m.KeywordLocation("exclusiveMinimum"), "exclusiveMinimum", excMin_raw, ErrInvalidSchemaFormat, "must be a boolean, but got %s", getJsonTypeOf(excMin_raw))
 		}
 	} else {
 		s.exclusiveMinimum = false
@@ -51,7 +57,7 @@ func newSubProp_minimum(schema map[string]interface{}, m *schemaProperty) (schem
 	return s, nil
 }
 
-func (s *schemaPropertySub_minimum) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_minimum) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	val, ok := src.(float64)
 	if !ok {
 		return true
@@ -59,9 +65,15 @@ func (s *schemaPropertySub_minimum) IsValid(src interface{}) bool {
 
 	switch s.exclusiveMinimum {
 	case true:
-		return val > s.minimum
+		if val > s.minimum {
+			return true
+		}
+		ctx.AddError(ptr, s.location, s.keyword, "must be greater than %v, but got %v", s.minimum, val)
 	case false:
-		return val >= s.minimum
+		if val >= s.minimum {
+			return true
+		}
+		ctx.AddError(ptr, s.location, s.keyword, "must be greater than or equal to %v, but got %v", s.minimum, val)
 	}
 
 	return false
@@ -69,6 +81,8 @@ func (s *schemaPropertySub_minimum) IsValid(src interface{}) bool {
 
 // defined at 5.1.2.(@Validation)
 type schemaPropertySub_maximum struct {
+	location         string
+	keyword          string
 	maximum          float64
 	exclusiveMaximum bool
 }
@@ -80,26 +94,28 @@ func newSubProp_maximum(schema map[string]interface{}, m *schemaProperty) (schem
 	if !max_exist {
 		if excMax_exist {
 			// If "exclusiveMaximum" is present, "maximum" MUST also be present.
-			return nil, ErrInvalidSchemaFormat
+			return nil, newSchemaError(m.KeywordLocation("exclusiveMaximum"), "exclusiveMaximum", excMax_raw, ErrInvalidSchemaFormat, "requires \"maximum\"")
 		} else {
 			return nil, nil
 		}
 	}
 
 	s := new(schemaPropertySub_maximum)
+	s.location = m.KeywordLocation("maximum")
+	s.keyword = "maximum"
 
 	ok := false
 	s.maximum, ok = max_raw.(float64)
 	if !ok {
 		// must JSON number
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("maximum"), "maximum", max_raw, ErrInvalidSchemaFormat, "must be a number, but got %s", getJsonTypeOf(max_raw))
 	}
 
 	if excMax_exist {
 		s.exclusiveMaximum, ok = excMax_raw.(bool)
 		if !ok {
 			// must boolean
-			return nil, ErrInvalidSchemaFormat
+			return nil, newSchemaError(m.KeywordLocation("exclusiveMaximum"), "exclusiveMaximum", excMax_raw, ErrInvalidSchemaFormat, "must be a boolean, but got %s", getJsonTypeOf(excMax_raw))
 		}
 	} else {
 		s.exclusiveMaximum = false
@@ -108,7 +124,7 @@ func newSubProp_maximum(schema map[string]interface{}, m *schemaProperty) (schem
 	return s, nil
 }
 
-func (s *schemaPropertySub_maximum) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_maximum) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	val, ok := src.(float64)
 	if !ok {
 		return true
@@ -116,9 +132,15 @@ func (s *schemaPropertySub_maximum) IsValid(src interface{}) bool {
 
 	switch s.exclusiveMaximum {
 	case true:
-		return val < s.maximum
+		if val < s.maximum {
+			return true
+		}
+		ctx.AddError(ptr, s.location, s.keyword, "must be less than %v, but got %v", s.maximum, val)
 	case false:
-		return val <= s.maximum
+		if val <= s.maximum {
+			return true
+		}
+		ctx.AddError(ptr, s.location, s.keyword, "must be less than or equal to %v, but got %v", s.maximum, val)
 	}
 
 	return false
@@ -126,7 +148,8 @@ func (s *schemaPropertySub_maximum) IsValid(src interface{}) bool {
 
 // defined at 5.4.2. (@Validation)
 type schemaPropertySub_minProperties struct {
-	value int
+	location string
+	value    int
 }
 
 func newSubProp_minProperties(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -136,27 +159,33 @@ func newSubProp_minProperties(schema map[string]interface{}, m *schemaProperty)
 	}
 
 	s := new(schemaPropertySub_minProperties)
+	s.location = m.KeywordLocation("minProperties")
 	prop_i, ok := getInteger(prop_raw)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("minProperties"), "minProperties", prop_raw, ErrInvalidSchemaFormat, "must be a non-negative integer, but got %s", formatJsonValue(prop_raw))
 	}
 
 	s.value = prop_i
 	return s, nil
 }
 
-func (s *schemaPropertySub_minProperties) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_minProperties) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	obj, ok := src.(map[string]interface{})
 	if !ok {
 		return true
 	}
 
-	return len(obj) >= s.value
+	if len(obj) < s.value {
+		ctx.AddError(ptr, s.location, "minProperties", "must have at least %d properties, but got %d", s.value, len(obj))
+		return false
+	}
+	return true
 }
 
 // defined at 5.4.1. (@Validation)
 type schemaPropertySub_maxProperties struct {
-	value int
+	location string
+	value    int
 }
 
 func newSubProp_maxProperties(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -166,27 +195,33 @@ func newSubProp_maxProperties(schema map[string]interface{}, m *schemaProperty)
 	}
 
 	s := new(schemaPropertySub_maxProperties)
+	s.location = m.KeywordLocation("maxProperties")
 	prop_i, ok := getInteger(prop_raw)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("maxProperties"), "maxProperties", prop_raw, ErrInvalidSchemaFormat, "must be a non-negative integer, but got %s", formatJsonValue(prop_raw))
 	}
 
 	s.value = prop_i
 	return s, nil
 }
 
-func (s *schemaPropertySub_maxProperties) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_maxProperties) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	obj, ok := src.(map[string]interface{})
 	if !ok {
 		return true
 	}
 
-	return len(obj) <= s.value
+	if len(obj) > s.value {
+		ctx.AddError(ptr, s.location, "maxProperties", "must have at most %d properties, but got %d", s.value, len(obj))
+		return false
+	}
+	return true
 }
 
 // defined at 5.4.1. (@Validation)
 type schemaPropertySub_maxLength struct {
-	value int
+	location string
+	value    int
 }
 
 func newSubProp_maxLength(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -196,27 +231,33 @@ func newSubProp_maxLength(schema map[string]interface{}, m *schemaProperty) (sch
 	}
 
 	s := new(schemaPropertySub_maxLength)
+	s.location = m.KeywordLocation("maxLength")
 	prop_i, ok := getInteger(prop_raw)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("maxLength"), "maxLength", prop_raw, ErrInvalidSchemaFormat, "must be a non-negative integer, but got %s", formatJsonValue(prop_raw))
 	}
 
 	s.value = prop_i
 	return s, nil
 }
 
-func (s *schemaPropertySub_maxLength) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_maxLength) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	src_s, ok := src.(string)
 	if !ok {
 		return true
 	}
 
-	return len(src_s) <= s.value
+	if len(src_s) > s.value {
+		ctx.AddError(ptr, s.location, "maxLength", "length must be at most %d, but got %d", s.value, len(src_s))
+		return false
+	}
+	return true
 }
 
 // defined at 5.4.2. (@Validation)
 type schemaPropertySub_minLength struct {
-	value int
+	location string
+	value    int
 }
 
 func newSubProp_minLength(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -226,27 +267,33 @@ func newSubProp_minLength(schema map[string]interface{}, m *schemaProperty) (sch
 	}
 
 	s := new(schemaPropertySub_minLength)
+	s.location = m.KeywordLocation("minLength")
 	prop_i, ok := getInteger(prop_raw)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("minLength"), "minLength", prop_raw, ErrInvalidSchemaFormat, "must be a non-negative integer, but got %s", formatJsonValue(prop_raw))
 	}
 
 	s.value = prop_i
 	return s, nil
 }
 
-func (s *schemaPropertySub_minLength) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_minLength) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	src_s, ok := src.(string)
 	if !ok {
 		return true
 	}
 
-	return len(src_s) >= s.value
+	if len(src_s) < s.value {
+		ctx.AddError(ptr, s.location, "minLength", "length must be at least %d, but got %d", s.value, len(src_s))
+		return false
+	}
+	return true
 }
 
 // defined at 5.3.2. (@Validation)
 type schemaPropertySub_maxItems struct {
-	value int
+	location string
+	value    int
 }
 
 func newSubProp_maxItems(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -256,27 +303,33 @@ func newSubProp_maxItems(schema map[string]interface{}, m *schemaProperty) (sche
 	}
 
 	s := new(schemaPropertySub_maxItems)
+	s.location = m.KeywordLocation("maxItems")
 	prop_i, ok := getInteger(prop_raw)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("maxItems"), "maxItems", prop_raw, ErrInvalidSchemaFormat, "must be a non-negative integer, but got %s", formatJsonValue(prop_raw))
 	}
 
 	s.value = prop_i
 	return s, nil
 }
 
-func (s *schemaPropertySub_maxItems) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_maxItems) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	src_a, ok := src.([]interface{})
 	if !ok {
 		return true
 	}
 
-	return len(src_a) <= s.value
+	if len(src_a) > s.value {
+		ctx.AddError(ptr, s.location, "maxItems", "must have at most %d items, but got %d", s.value, len(src_a))
+		return false
+	}
+	return true
 }
 
 // defined at 5.3.3. (@Validation)
 type schemaPropertySub_minItems struct {
-	value int
+	location string
+	value    int
 }
 
 func newSubProp_minItems(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -286,27 +339,33 @@ func newSubProp_minItems(schema map[string]interface{}, m *schemaProperty) (sche
 	}
 
 	s := new(schemaPropertySub_minItems)
+	s.location = m.KeywordLocation("minItems")
 	prop_i, ok := getInteger(prop_raw)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("minItems"), "minItems", prop_raw, ErrInvalidSchemaFormat, "must be a non-negative integer, but got %s", formatJsonValue(prop_raw))
 	}
 
 	s.value = prop_i
 	return s, nil
 }
 
-func (s *schemaPropertySub_minItems) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_minItems) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	src_a, ok := src.([]interface{})
 	if !ok {
 		return true
 	}
 
-	return len(src_a) >= s.value
+	if len(src_a) < s.value {
+		ctx.AddError(ptr, s.location, "minItems", "must have at least %d items, but got %d", s.value, len(src_a))
+		return false
+	}
+	return true
 }
 
 // defined at 5.2.3. (@Validation)
 type schemaPropertySub_pattern struct {
-	value *regexp.Regexp
+	location string
+	value    Regexp
 }
 
 func newSubProp_pattern(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -316,33 +375,45 @@ func newSubProp_pattern(schema map[string]interface{}, m *schemaProperty) (schem
 	}
 
 	s := new(schemaPropertySub_pattern)
+	s.location = m.KeywordLocation("pattern")
 	prop_s, ok := prop_raw.(string)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("pattern"), "pattern", prop_raw, ErrInvalidSchemaFormat, "must be a string, but got %s", getJsonTypeOf(prop_raw))
 	}
 
-	// FIXME: re2 is not compatible with ECMA-262.
-	exp, err := regexp.CompilePOSIX(prop_s)
+	v := m.schemaobject.validator
+	exp, err := v.regexpEngine(prop_s, v.regexpTimeout)
 	if err != nil {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("pattern"), "pattern", prop_raw, ErrInvalidSchemaFormat, "invalid regular expression: %v", err)
 	}
 
 	s.value = exp
 	return s, nil
 }
 
-func (s *schemaPropertySub_pattern) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_pattern) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	val, ok := src.(string)
 	if !ok {
 		return true
 	}
 
-	return s.value.Match([]byte(val))
+	matched, err := s.value.MatchString(val)
+	if err != nil {
+		ctx.Abort(fmt.Errorf("%w at '%s' (%s): %v", ErrRegexpTimeout, ptr, s.location, err))
+		return false
+	}
+
+	if !matched {
+		ctx.AddError(ptr, s.location, "pattern", "does not match pattern %q", s.value.String())
+		return false
+	}
+	return true
 }
 
 // defined at 5.3.4
 type schemaPropertySub_uniqueItem struct {
-	value bool
+	location string
+	value    bool
 }
 
 func newSubProp_uniqueItem(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -352,16 +423,17 @@ func newSubProp_uniqueItem(schema map[string]interface{}, m *schemaProperty) (sc
 	}
 
 	s := new(schemaPropertySub_uniqueItem)
+	s.location = m.KeywordLocation("uniqueItems")
 	prop_b, ok := prop_raw.(bool)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("uniqueItems"), "uniqueItems", prop_raw, ErrInvalidSchemaFormat, "must be a boolean, but got %s", getJsonTypeOf(prop_raw))
 	}
 
 	s.value = prop_b
 	return s, nil
 }
 
-func (s *schemaPropertySub_uniqueItem) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_uniqueItem) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	val, ok := src.([]interface{})
 	if !ok {
 		return true
@@ -373,8 +445,9 @@ func (s *schemaPropertySub_uniqueItem) IsValid(src interface{}) bool {
 	}
 
 	for k1, v1 := range val {
-		for k2, v2 := range val {
-			if reflect.DeepEqual(v1, v2) && k1 != k2 {
+		for k2 := k1 + 1; k2 < len(val); k2++ {
+			if reflect.DeepEqual(v1, val[k2]) {
+				ctx.AddError(ptr, s.location, "uniqueItems", "items at %d and %d are equal", k1, k2)
 				return false
 			}
 		}
@@ -385,7 +458,8 @@ func (s *schemaPropertySub_uniqueItem) IsValid(src interface{}) bool {
 
 // defined at 5.4.3
 type schemaPropertySub_required struct {
-	value []string
+	location string
+	value    []string
 }
 
 func newSubProp_required(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -395,21 +469,22 @@ func newSubProp_required(schema map[string]interface{}, m *schemaProperty) (sche
 	}
 
 	s := new(schemaPropertySub_required)
+	s.location = m.KeywordLocation("required")
 	prop_a, ok := prop_raw.([]interface{})
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("required"), "required", prop_raw, ErrInvalidSchemaFormat, "must be an array, but got %s", getJsonTypeOf(prop_raw))
 	}
 
 	prop_s := convInterfaceArrayToStringArray(prop_a)
 	if prop_s == nil {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("required"), "required", prop_raw, ErrInvalidSchemaFormat, "must be an array of strings")
 	}
 
 	// values are must unique.
 	for k1, v1 := range prop_a {
 		for k2, v2 := range prop_a {
 			if v1 == v2 && k1 != k2 {
-				return nil, ErrInvalidSchemaFormat
+				return nil, newSchemaError(m.KeywordLocation("required"), "required", prop_raw, ErrInvalidSchemaFormat, "must be unique, but %s is duplicated", formatJsonValue(v1))
 			}
 		}
 	}
@@ -418,107 +493,158 @@ func newSubProp_required(schema map[string]interface{}, m *schemaProperty) (sche
 	return s, nil
 }
 
-func (s *schemaPropertySub_required) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_required) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	val, ok := src.(map[string]interface{})
 	if !ok {
 		return true
 	}
 
+	valid := true
 	for _, v := range s.value {
 		_, ok := val[v]
 		if !ok {
 			// elements not found
-			return false
+			ctx.AddError(ptr, s.location, "required", "missing required property %q", v)
+			valid = false
+			if !ctx.ShouldContinue() {
+				return false
+			}
 		}
 	}
 
-	return true
+	return valid
 }
 
 // defined at 5.4.5
 type schemaPropertySub_dependency struct {
+	location    string
+	keyword     string
 	elementname map[string][]string
 	validation  map[string]*schemaProperty
 }
 
 func newSubProp_dependency(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
-	dep, ok := schema["dependencies"]
+	return newDependency(schema, m, "dependencies")
+}
+
+// defined at 6.5.4 (@Validation 2019-09)
+func newSubProp_dependentRequired(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newDependency(schema, m, "dependentRequired")
+}
+
+// defined at 9.2.2.4 (@Core 2019-09)
+func newSubProp_dependentSchemas(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newDependency(schema, m, "dependentSchemas")
+}
+
+// newDependency returns the dependencies of the keyword.
+// "dependencies" accepts both of property names and schemas, which are separated to "dependentRequired" and "dependentSchemas" since 2019-09.
+func newDependency(schema map[string]interface{}, m *schemaProperty, keyword string) (schemaPropertySub, error) {
+	dep, ok := schema[keyword]
 	if !ok {
 		return nil, nil
 	}
 
 	depobjs, ok := dep.(map[string]interface{})
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation(keyword), keyword, dep, ErrInvalidSchemaFormat, "must be an object, but got %s", getJsonTypeOf(dep))
 	}
 
 	s := &schemaPropertySub_dependency{
+		location:    m.KeywordLocation(keyword),
+		keyword:     keyword,
 		elementname: make(map[string][]string),
 		validation:  make(map[string]*schemaProperty, 0),
 	}
-	for name, value := range depobjs {
+	for _, name := range sortedKeys(depobjs) {
+		value := depobjs[name]
 		switch depobj := value.(type) {
+		case string:
+			// a single property name is allowed in draft3.
+			if m.dialect.schemaType != SchemaType_Draft3 {
+				return nil, newSchemaError(m.KeywordLocation(keyword, name), keyword, value, ErrInvalidSchemaFormat, "must be an array or a schema, but got string")
+			}
+			s.elementname[name] = []string{depobj}
+
 		case []interface{}:
+			if keyword == "dependentSchemas" {
+				return nil, newSchemaError(m.KeywordLocation(keyword, name), keyword, value, ErrInvalidSchemaFormat, "must be a schema, but got array")
+			}
+
 			val := convInterfaceArrayToStringArray(depobj)
 			if val == nil {
-				return nil, ErrInvalidSchemaFormat
+				return nil, newSchemaError(m.KeywordLocation(keyword, name), keyword, value, ErrInvalidSchemaFormat, "must be an array of strings")
 			}
 			s.elementname[name] = val
 
-		case map[string]interface{}:
-			news := m.NewChild()
-			err := news.Recognize(depobj)
+		default:
+			if keyword == "dependentRequired" {
+				return nil, newSchemaError(m.KeywordLocation(keyword, name), keyword, value, ErrInvalidSchemaFormat, "must be an array, but got %s", getJsonTypeOf(value))
+			}
+
+			news := m.NewBrother(keyword, name)
+			err := news.RecognizeSchema(depobj)
 			if err != nil {
-				return nil, ErrInvalidSchemaFormat
+				return nil, err
 			}
 			s.validation[name] = news
-
-		default:
-			return nil, ErrInvalidSchemaFormat
 		}
 	}
 
 	return s, nil
 }
 
-func (s *schemaPropertySub_dependency) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_dependency) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	obj, ok := src.(map[string]interface{})
 	if !ok {
 		return true
 	}
 
+	valid := true
+
+	names := sortedKeys(obj)
+
 	// keyname
-	for name, deps := range s.elementname {
-		if _, ok := obj[name]; !ok {
-			// specified element was not found
+	for _, name := range names {
+		deps, ok := s.elementname[name]
+		if !ok {
 			continue
 		}
 
 		for _, dep := range deps {
 			// is depenedant keys exist?
 			if _, ok := obj[dep]; !ok {
-				return false
+				ctx.AddError(ptr, s.location, s.keyword, "property %q is required by property %q", dep, name)
+				valid = false
+				if !ctx.ShouldContinue() {
+					return false
+				}
 			}
 		}
 	}
 
 	// element schema
-	for name, dep := range s.validation {
-		if _, ok := obj[name]; !ok {
+	for _, name := range names {
+		dep, ok := s.validation[name]
+		if !ok {
 			continue
 		}
 
-		if !dep.IsValid(obj) {
-			return false
+		if !dep.Validate(ctx, obj, ptr) {
+			valid = false
+			if !ctx.ShouldContinue() {
+				return false
+			}
 		}
 	}
 
-	return true
+	return valid
 }
 
 // defined at 5.5.1
 type schemaPropertySub_enum struct {
-	value []interface{}
+	location string
+	value    []interface{}
 }
 
 func newSubProp_enum(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -528,27 +654,31 @@ func newSubProp_enum(schema map[string]interface{}, m *schemaProperty) (schemaPr
 	}
 
 	s := new(schemaPropertySub_enum)
+	s.location = m.KeywordLocation("enum")
 	prop, ok := prop_raw.([]interface{})
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("enum"), "enum", prop_raw, ErrInvalidSchemaFormat, "must be an array, but got %s", getJsonTypeOf(prop_raw))
 	}
 
 	s.value = prop
 	return s, nil
 }
 
-func (s *schemaPropertySub_enum) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_enum) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	for _, v := range s.value {
 		if reflect.DeepEqual(v, src) {
 			return true
 		}
 	}
+
+	ctx.AddError(ptr, s.location, "enum", "must be one of the enumerated values")
 	return false
 }
 
 // defined at 5.5.3
 type schemaPropertySub_allOf struct {
-	value []*schemaProperty
+	location string
+	value    []*schemaProperty
 }
 
 func newSubProp_allOf(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -559,22 +689,17 @@ func newSubProp_allOf(schema map[string]interface{}, m *schemaProperty) (schemaP
 
 	props, ok := props_raw.([]interface{})
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("allOf"), "allOf", props_raw, ErrInvalidSchemaFormat, "must be an array, but got %s", getJsonTypeOf(props_raw))
 	}
 
 	s := &schemaPropertySub_allOf{
-		value: make([]*schemaProperty, 0),
+		location: m.KeywordLocation("allOf"),
+		value:    make([]*schemaProperty, 0),
 	}
 
-	for _, prop := range props {
-		news := m.NewBrother()
-
-		prop_map, ok := prop.(map[string]interface{})
-		if !ok {
-			return nil, ErrInvalidSchemaFormat
-		}
-
-		err := news.Recognize(prop_map)
+	for i, prop := range props {
+		news := m.NewBrother("allOf", strconv.Itoa(i))
+		err := news.RecognizeSchema(prop)
 		if err != nil {
 			return nil, err
 		}
@@ -584,18 +709,26 @@ func newSubProp_allOf(schema map[string]interface{}, m *schemaProperty) (schemaP
 	return s, nil
 }
 
-func (s *schemaPropertySub_allOf) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_allOf) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	valid := true
 	for _, v := range s.value {
-		if !v.IsValid(src) {
-			return false
+		if !v.Validate(ctx, src, ptr) {
+			valid = false
+			if !ctx.ShouldContinue() {
+				return false
+			}
 		}
 	}
-	return true
+	return valid
 }
 
 // defined at 5.5.4
 type schemaPropertySub_anyOf struct {
-	value []*schemaProperty
+	location string
+	value    []*schemaProperty
+	// annotations reports whether every subschema is evaluated, to collect the annotations of all succeeded ones.
+	// They are needed only by the dialects which have unevaluatedProperties and unevaluatedItems.
+	annotations bool
 }
 
 func newSubProp_anyOf(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -606,22 +739,18 @@ func newSubProp_anyOf(schema map[string]interface{}, m *schemaProperty) (schemaP
 
 	props, ok := props_raw.([]interface{})
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("anyOf"), "anyOf", props_raw, ErrInvalidSchemaFormat, "must be an array, but got %s", getJsonTypeOf(props_raw))
 	}
 
 	s := &schemaPropertySub_anyOf{
-		value: make([]*schemaProperty, 0),
+		location:    m.KeywordLocation("anyOf"),
+		value:       make([]*schemaProperty, 0),
+		annotations: len(m.dialect.lateCreaters) > 0,
 	}
 
-	for _, prop := range props {
-		news := m.NewBrother()
-
-		prop_map, ok := prop.(map[string]interface{})
-		if !ok {
-			return nil, ErrInvalidSchemaFormat
-		}
-
-		err := news.Recognize(prop_map)
+	for i, prop := range props {
+		news := m.NewBrother("anyOf", strconv.Itoa(i))
+		err := news.RecognizeSchema(prop)
 		if err != nil {
 			return nil, err
 		}
@@ -631,19 +760,36 @@ func newSubProp_anyOf(schema map[string]interface{}, m *schemaProperty) (schemaP
 	return s, nil
 }
 
-func (s *schemaPropertySub_anyOf) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_anyOf) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	// the first succeeded subschema is enough, unless the annotations or the results of all of them are needed.
+	all := s.annotations || ctx.unit != nil
+	matched := false
+	branches := make([]*evalContext, 0, len(s.value))
 	for _, sub := range s.value {
-		if sub.IsValid(src) {
-			return true
+		branch := ctx.NewBranch()
+		branches = append(branches, branch)
+		if sub.Validate(branch, src, ptr) {
+			ctx.MergeBranch(branch)
+			matched = true
+			if !all {
+				break
+			}
 		}
 	}
 
-	return false
+	if !matched {
+		ctx.AddBranchError(branches, ptr, s.location, "anyOf", "must be valid against at least one of the subschemas")
+		return false
+	}
+
+	ctx.AddBranchResult(branches, ptr, s.location)
+	return true
 }
 
 // defined at 5.5.5
 type schemaPropertySub_oneOf struct {
-	value []*schemaProperty
+	location string
+	value    []*schemaProperty
 }
 
 func newSubProp_oneOf(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -654,21 +800,17 @@ func newSubProp_oneOf(schema map[string]interface{}, m *schemaProperty) (schemaP
 
 	props, ok := props_raw.([]interface{})
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("oneOf"), "oneOf", props_raw, ErrInvalidSchemaFormat, "must be an array, but got %s", getJsonTypeOf(props_raw))
 	}
 
 	s := &schemaPropertySub_oneOf{
-		value: make([]*schemaProperty, 0),
+		location: m.KeywordLocation("oneOf"),
+		value:    make([]*schemaProperty, 0),
 	}
 
-	for _, prop := range props {
-		prop_map, ok := prop.(map[string]interface{})
-		if !ok {
-			return nil, ErrInvalidSchemaFormat
-		}
-
-		news := m.NewBrother()
-		err := news.Recognize(prop_map)
+	for i, prop := range props {
+		news := m.NewBrother("oneOf", strconv.Itoa(i))
+		err := news.RecognizeSchema(prop)
 		if err != nil {
 			return nil, err
 		}
@@ -678,23 +820,33 @@ func newSubProp_oneOf(schema map[string]interface{}, m *schemaProperty) (schemaP
 	return s, nil
 }
 
-func (s *schemaPropertySub_oneOf) IsValid(src interface{}) bool {
-	cond := false
+func (s *schemaPropertySub_oneOf) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	matched := 0
+	var succeeded *evalContext
+	branches := make([]*evalContext, 0, len(s.value))
 	for _, v := range s.value {
-		if !v.IsValid(src) {
-			if cond {
-				return false
-			}
-			cond = true
+		branch := ctx.NewBranch()
+		branches = append(branches, branch)
+		if v.Validate(branch, src, ptr) {
+			matched = matched + 1
+			succeeded = branch
 		}
 	}
 
-	return cond
+	if matched != 1 {
+		ctx.AddBranchError(branches, ptr, s.location, "oneOf", "must be valid against exactly one of the subschemas, but matched %d", matched)
+		return false
+	}
+
+	ctx.MergeBranch(succeeded)
+	ctx.AddBranchResult(branches, ptr, s.location)
+	return true
 }
 
 // defined at 5.5.5
 type schemaPropertySub_not struct {
-	value *schemaProperty
+	location string
+	value    *schemaProperty
 }
 
 func newSubProp_not(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -703,14 +855,10 @@ func newSubProp_not(schema map[string]interface{}, m *schemaProperty) (schemaPro
 		return nil, nil
 	}
 
-	prop, ok := prop_raw.(map[string]interface{})
-	if !ok {
-		return nil, ErrInvalidSchemaFormat
-	}
-
 	s := new(schemaPropertySub_not)
-	news := m.NewBrother()
-	err := news.Recognize(prop)
+	s.location = m.KeywordLocation("not")
+	news := m.NewBrother("not")
+	err := news.RecognizeSchema(prop_raw)
 	if err != nil {
 		return nil, err
 	}
@@ -719,13 +867,22 @@ func newSubProp_not(schema map[string]interface{}, m *schemaProperty) (schemaPro
 	return s, nil
 }
 
-func (s *schemaPropertySub_not) IsValid(src interface{}) bool {
-	return !s.value.IsValid(src)
+func (s *schemaPropertySub_not) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	branch := ctx.NewBranch()
+	if s.value.Validate(branch, src, ptr) {
+		ctx.AddBranchError([]*evalContext{branch}, ptr, s.location, "not", "must not be valid against the subschema")
+		return false
+	}
+
+	ctx.AddBranchResult([]*evalContext{branch}, ptr, s.location)
+	return true
 }
 
 // defined at 5.5.5
 type schemaPropertySub_multipleOf struct {
-	value float64
+	location string
+	keyword  string
+	value    float64
 }
 
 func newSubProp_multipleOf(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
@@ -736,19 +893,845 @@ func newSubProp_multipleOf(schema map[string]interface{}, m *schemaProperty) (sc
 
 	prop, ok := prop_raw.(float64)
 	if !ok {
-		return nil, ErrInvalidSchemaFormat
+		return nil, newSchemaError(m.KeywordLocation("multipleOf"), "multipleOf", prop_raw, ErrInvalidSchemaFormat, "must be a number, but got %s", getJsonTypeOf(prop_raw))
 	}
 
 	s := new(schemaPropertySub_multipleOf)
+	s.location = m.KeywordLocation("multipleOf")
+	s.keyword = "multipleOf"
 	s.value = prop
 	return s, nil
 }
 
-func (s *schemaPropertySub_multipleOf) IsValid(src interface{}) bool {
+func (s *schemaPropertySub_multipleOf) Validate(ctx *evalContext, src interface{}, ptr string) bool {
 	val, ret := src.(float64)
 	if !ret {
 		return true
 	}
 
-	return math.Mod(val*10e10, s.value*10e10) == 0
+	if math.Mod(val*10e10, s.value*10e10) != 0 {
+		ctx.AddError(ptr, s.location, s.keyword, "must be a multiple of %v, but got %v", s.value, val)
+		return false
+	}
+	return true
+}
+
+// defined at 7. (@Validation)
+type schemaPropertySub_format struct {
+	location string
+	name     string
+	checker  FormatChecker
+}
+
+func newSubProp_format(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["format"]
+	if !exist {
+		return nil, nil
+	}
+
+	prop, ok := prop_raw.(string)
+	if !ok {
+		return nil, newSchemaError(m.KeywordLocation("format"), "format", prop_raw, ErrInvalidSchemaFormat, "must be a string, but got %s", getJsonTypeOf(prop_raw))
+	}
+
+	v := m.schemaobject.validator
+	checker, ok := v.formats[prop]
+	if !ok {
+		checker, ok = getFormatChecker(prop)
+	}
+
+	if !ok {
+		switch v.unknownFormatPolicy {
+		case UnknownFormatPolicy_Warn:
+			v.warnings = append(v.warnings, fmt.Sprintf("unknown format %q at %s", prop, m.KeywordLocation("format")))
+		case UnknownFormatPolicy_Fail:
+			return nil, newSchemaError(m.KeywordLocation("format"), "format", prop_raw, ErrUnknownFormat, "unknown format %q", prop)
+		}
+		return nil, nil
+	}
+
+	if !v.formatAssertion {
+		// annotation only
+		return nil, nil
+	}
+
+	s := new(schemaPropertySub_format)
+	s.location = m.KeywordLocation("format")
+	s.name = prop
+	s.checker = checker
+	return s, nil
+}
+
+func (s *schemaPropertySub_format) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	if !s.checker(src) {
+		ctx.AddError(ptr, s.location, "format", "is not a valid %s", s.name)
+		return false
+	}
+	return true
+}
+
+// defined at 5.1 and 5.25 (@Draft3)
+type schemaPropertySub_type3 struct {
+	location string
+	keyword  string
+	types    []JsonType
+	schemas  []*schemaProperty
+	disallow bool
+}
+
+func newSubProp_type3(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newDraft3Types(schema, m, "type")
+}
+
+func newSubProp_disallow(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newDraft3Types(schema, m, "disallow")
+}
+
+func newDraft3Types(schema map[string]interface{}, m *schemaProperty, keyword string) (schemaPropertySub, error) {
+	prop_raw, exist := schema[keyword]
+	if !exist {
+		return nil, nil
+	}
+
+	s := &schemaPropertySub_type3{
+		location: m.KeywordLocation(keyword),
+		keyword:  keyword,
+		types:    make([]JsonType, 0),
+		schemas:  make([]*schemaProperty, 0),
+		disallow: keyword == "disallow",
+	}
+
+	// a single type is located at the keyword itself, and the elements of an array at their indexes.
+	props, isArray := prop_raw.([]interface{})
+	if !isArray {
+		props = []interface{}{prop_raw}
+	}
+	locationOf := func(i int) []string {
+		if !isArray {
+			return []string{keyword}
+		}
+		return []string{keyword, strconv.Itoa(i)}
+	}
+
+	for i, prop := range props {
+		switch typename := prop.(type) {
+		case string:
+			if typename == "any" {
+				s.types = append(s.types, JsonType_Any)
+				continue
+			}
+
+			t, err := GetJsonType(typename)
+			if err != nil {
+				return nil, newSchemaError(m.KeywordLocation(keyword), keyword, prop_raw, err, "unknown type %q", typename)
+			}
+			s.types = append(s.types, t)
+
+		case map[string]interface{}:
+			news := m.NewBrother(locationOf(i)...)
+			err := news.Recognize(typename)
+			if err != nil {
+				return nil, err
+			}
+			s.schemas = append(s.schemas, news)
+
+		default:
+			return nil, newSchemaError(m.KeywordLocation(locationOf(i)...), keyword, prop, ErrInvalidSchemaFormat, "must be a type name or a schema, but got %s", getJsonTypeOf(prop))
+		}
+	}
+
+	return s, nil
+}
+
+func (s *schemaPropertySub_type3) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	matched := false
+	for _, t := range s.types {
+		if t.IsMatched(src) {
+			matched = true
+			break
+		}
+	}
+
+	branches := make([]*evalContext, 0, len(s.schemas))
+	for _, sub := range s.schemas {
+		if matched {
+			break
+		}
+		branch := ctx.NewBranch()
+		branches = append(branches, branch)
+		matched = sub.Validate(branch, src, ptr)
+	}
+
+	if s.disallow && matched {
+		ctx.AddBranchError(branches, ptr, s.location, s.keyword, "must not be %s", getJsonTypeOf(src))
+		return false
+	} else if !s.disallow && !matched {
+		ctx.AddBranchError(branches, ptr, s.location, s.keyword, "got %s, which is not allowed", getJsonTypeOf(src))
+		return false
+	}
+	ctx.AddBranchResult(branches, ptr, s.location)
+	return true
+}
+
+// defined at 5.7 (@Draft3)
+type schemaPropertySub_required3 struct {
+	// value holds the names of the required properties, and locations holds "required" of each property by its name.
+	value     []string
+	locations map[string]string
+}
+
+func newSubProp_required3(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	if required, exist := schema["required"]; exist {
+		if _, ok := required.(bool); !ok {
+			return nil, newSchemaError(m.KeywordLocation("required"), "required", required, ErrInvalidSchemaFormat, "must be a boolean, but got %s", getJsonTypeOf(required))
+		}
+	}
+
+	props, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	names := make([]string, 0)
+	for name, prop := range props {
+		prop_map, ok := prop.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if required, ok := prop_map["required"].(bool); ok && required {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	s := new(schemaPropertySub_required3)
+	s.value = names
+	s.locations = make(map[string]string, len(names))
+	for _, name := range names {
+		s.locations[name] = m.KeywordLocation("properties", name, "required")
+	}
+	return s, nil
+}
+
+func (s *schemaPropertySub_required3) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	val, ok := src.(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	valid := true
+	for _, v := range s.value {
+		if _, ok := val[v]; !ok {
+			ctx.AddError(ptr, s.locations[v], "required", "missing required property %q", v)
+			valid = false
+			if !ctx.ShouldContinue() {
+				return false
+			}
+		}
+	}
+	return valid
+}
+
+// defined at 5.26 (@Draft3)
+func newSubProp_extends(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["extends"]
+	if !exist {
+		return nil, nil
+	}
+
+	s := &schemaPropertySub_allOf{
+		location: m.KeywordLocation("extends"),
+		value:    make([]*schemaProperty, 0),
+	}
+
+	if prop, ok := prop_raw.(map[string]interface{}); ok {
+		news := m.NewBrother("extends")
+		err := news.Recognize(prop)
+		if err != nil {
+			return nil, err
+		}
+		s.value = append(s.value, news)
+		return s, nil
+	}
+
+	props, ok := prop_raw.([]interface{})
+	if !ok {
+		return nil, newSchemaError(m.KeywordLocation("extends"), "extends", prop_raw, ErrInvalidSchemaFormat, "must be a schema or an array of schemas, but got %s", getJsonTypeOf(prop_raw))
+	}
+
+	for i, prop := range props {
+		prop_map, ok := prop.(map[string]interface{})
+		if !ok {
+			return nil, newSchemaError(m.KeywordLocation("extends", strconv.Itoa(i)), "extends", prop, ErrInvalidSchemaFormat, "must be a schema, but got %s", getJsonTypeOf(prop))
+		}
+
+		news := m.NewBrother("extends", strconv.Itoa(i))
+		err := news.Recognize(prop_map)
+		if err != nil {
+			return nil, err
+		}
+		s.value = append(s.value, news)
+	}
+
+	return s, nil
+}
+
+// defined at 5.24 (@Draft3)
+func newSubProp_divisibleBy(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["divisibleBy"]
+	if !exist {
+		return nil, nil
+	}
+
+	prop, ok := prop_raw.(float64)
+	if !ok || prop == 0 {
+		return nil, newSchemaError(m.KeywordLocation("divisibleBy"), "divisibleBy", prop_raw, ErrInvalidSchemaFormat, "must be a non-zero number, but got %s", formatJsonValue(prop_raw))
+	}
+
+	s := new(schemaPropertySub_multipleOf)
+	s.location = m.KeywordLocation("divisibleBy")
+	s.keyword = "divisibleBy"
+	s.value = prop
+	return s, nil
+}
+
+// defined at 6.2 and 6.3 (@Validation draft6)
+func newSubProp_maximum6(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newNumericLimit6(schema, m, "maximum")
+}
+
+func newSubProp_exclusiveMaximum6(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newNumericLimit6(schema, m, "exclusiveMaximum")
+}
+
+// defined at 6.4 and 6.5 (@Validation draft6)
+func newSubProp_minimum6(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newNumericLimit6(schema, m, "minimum")
+}
+
+func newSubProp_exclusiveMinimum6(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newNumericLimit6(schema, m, "exclusiveMinimum")
+}
+
+// newNumericLimit6 returns the limit whose exclusiveness is decided by its keyword, instead of a boolean of draft4.
+func newNumericLimit6(schema map[string]interface{}, m *schemaProperty, keyword string) (schemaPropertySub, error) {
+	prop_raw, exist := schema[keyword]
+	if !exist {
+		return nil, nil
+	}
+
+	prop, ok := prop_raw.(float64)
+	if !ok {
+		return nil, newSchemaError(m.KeywordLocation(keyword), keyword, prop_raw, ErrInvalidSchemaFormat, "must be a number, but got %s", getJsonTypeOf(prop_raw))
+	}
+
+	switch keyword {
+	case "maximum", "exclusiveMaximum":
+		return &schemaPropertySub_maximum{
+			location:         m.KeywordLocation(keyword),
+			keyword:          keyword,
+			maximum:          prop,
+			exclusiveMaximum: keyword == "exclusiveMaximum",
+		}, nil
+	default:
+		return &schemaPropertySub_minimum{
+			location:         m.KeywordLocation(keyword),
+			keyword:          keyword,
+			minimum:          prop,
+			exclusiveMinimum: keyword == "exclusiveMinimum",
+		}, nil
+	}
+}
+
+// defined at 6.24 (@Validation draft6)
+type schemaPropertySub_const struct {
+	location string
+	value    interface{}
+}
+
+func newSubProp_const(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["const"]
+	if !exist {
+		return nil, nil
+	}
+
+	s := new(schemaPropertySub_const)
+	s.location = m.KeywordLocation("const")
+	s.value = prop_raw
+	return s, nil
+}
+
+func (s *schemaPropertySub_const) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	if !reflect.DeepEqual(s.value, src) {
+		ctx.AddError(ptr, s.location, "const", "must be equal to the constant value")
+		return false
+	}
+	return true
+}
+
+// defined at 6.14 (@Validation draft6)
+type schemaPropertySub_contains struct {
+	location string
+	value    *schemaProperty
+
+	// limits reports whether minContains and maxContains are supported. (since 2019-09)
+	limits      bool
+	minKeyword  string
+	minLocation string
+	minContains int
+	maxLocation string
+	maxContains int
+
+	// annotate reports whether the matched items are evaluated for unevaluatedItems. (since 2020-12)
+	annotate bool
+}
+
+func newSubProp_contains(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newContains(schema, m, false, false)
+}
+
+// defined at 6.4.4 and 6.4.5 (@Validation 2019-09)
+func newSubProp_contains2019(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newContains(schema, m, true, false)
+}
+
+// defined at 10.3.1.3 (@Core 2020-12)
+func newSubProp_contains2020(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	return newContains(schema, m, true, true)
+}
+
+func newContains(schema map[string]interface{}, m *schemaProperty, limits, annotate bool) (schemaPropertySub, error) {
+	prop_raw, exist := schema["contains"]
+	if !exist {
+		// "minContains" and "maxContains" are ignored without "contains".
+		return nil, nil
+	}
+
+	s := new(schemaPropertySub_contains)
+	s.location = m.KeywordLocation("contains")
+	s.limits = limits
+	s.annotate = annotate
+	s.minKeyword = "contains"
+	s.minLocation = s.location
+	s.minContains = 1
+	s.maxContains = -1
+
+	news := m.NewChild("contains")
+	err := news.RecognizeSchema(prop_raw)
+	if err != nil {
+		return nil, err
+	}
+	s.value = news
+
+	if !limits {
+		return s, nil
+	}
+
+	if min_raw, ok := schema["minContains"]; ok {
+		s.minContains, ok = getInteger(min_raw)
+		if !ok {
+			return nil, newSchemaError(m.KeywordLocation("minContains"), "minContains", min_raw, ErrInvalidSchemaFormat, "must be a non-negative integer, but got %s", formatJsonValue(min_raw))
+		}
+		s.minKeyword = "minContains"
+		s.minLocation = m.KeywordLocation("minContains")
+	}
+
+	if max_raw, ok := schema["maxContains"]; ok {
+		s.maxContains, ok = getInteger(max_raw)
+		if !ok {
+			return nil, newSchemaError(m.KeywordLocation("maxContains"), "maxContains", max_raw, ErrInvalidSchemaFormat, "must be a non-negative integer, but got %s", formatJsonValue(max_raw))
+		}
+		s.maxLocation = m.KeywordLocation("maxContains")
+	}
+
+	return s, nil
+}
+
+func (s *schemaPropertySub_contains) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	val, ok := src.([]interface{})
+	if !ok {
+		return true
+	}
+
+	matched := 0
+	branches := make([]*evalContext, 0, len(val))
+	for i, v := range val {
+		branch := ctx.NewBranch()
+		branches = append(branches, branch)
+		if s.value.Validate(branch, v, ptr+"/"+strconv.Itoa(i)) {
+			matched = matched + 1
+			if s.annotate {
+				ctx.AnnotateItem(i)
+			}
+			if !s.limits {
+				// a matched item is enough.
+				break
+			}
+		}
+	}
+
+	if matched < s.minContains {
+		if s.minKeyword == "contains" {
+			ctx.AddBranchError(branches, ptr, s.minLocation, s.minKeyword, "must contain at least one item which is valid against the subschema")
+		} else {
+			ctx.AddBranchError(branches, ptr, s.minLocation, s.minKeyword, "must contain at least %d items which are valid against the subschema, but got %d", s.minContains, matched)
+		}
+		return false
+	}
+
+	if s.maxContains >= 0 && matched > s.maxContains {
+		ctx.AddBranchError(branches, ptr, s.maxLocation, "maxContains", "must contain at most %d items which are valid against the subschema, but got %d", s.maxContains, matched)
+		return false
+	}
+
+	ctx.AddBranchResult(branches, ptr, s.location)
+	return true
+}
+
+// defined at 6.22 (@Validation draft6)
+type schemaPropertySub_propertyNames struct {
+	location string
+	value    *schemaProperty
+}
+
+func newSubProp_propertyNames(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["propertyNames"]
+	if !exist {
+		return nil, nil
+	}
+
+	s := new(schemaPropertySub_propertyNames)
+	s.location = m.KeywordLocation("propertyNames")
+	news := m.NewChild("propertyNames")
+	err := news.RecognizeSchema(prop_raw)
+	if err != nil {
+		return nil, err
+	}
+
+	s.value = news
+	return s, nil
+}
+
+func (s *schemaPropertySub_propertyNames) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	obj, ok := src.(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	valid := true
+	for _, k := range sortedKeys(obj) {
+		if !s.value.Validate(ctx, k, ptr) {
+			valid = false
+			if !ctx.ShouldContinue() {
+				return false
+			}
+		}
+	}
+	return valid
+}
+
+// defined at 6.6 (@Validation draft7)
+type schemaPropertySub_if struct {
+	location string
+	value    *schemaProperty
+	then     *schemaProperty
+	els      *schemaProperty
+}
+
+func newSubProp_if(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["if"]
+	if !exist {
+		// "then" and "else" are ignored without "if".
+		return nil, nil
+	}
+
+	s := new(schemaPropertySub_if)
+	s.location = m.KeywordLocation("if")
+	s.value = m.NewBrother("if")
+	err := s.value.RecognizeSchema(prop_raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if then_raw, ok := schema["then"]; ok {
+		s.then = m.NewBrother("then")
+		err := s.then.RecognizeSchema(then_raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if else_raw, ok := schema["else"]; ok {
+		s.els = m.NewBrother("else")
+		err := s.els.RecognizeSchema(else_raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *schemaPropertySub_if) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	branch := ctx.NewBranch()
+	matched := s.value.Validate(branch, src, ptr)
+	ctx.AddBranchResult([]*evalContext{branch}, ptr, s.location)
+	if matched {
+		ctx.MergeBranch(branch)
+	}
+
+	if matched && s.then != nil {
+		return s.then.Validate(ctx, src, ptr)
+	} else if !matched && s.els != nil {
+		return s.els.Validate(ctx, src, ptr)
+	}
+	return true
+}
+
+// defined at 8.2.4.1 (@Core 2019-09)
+// "$ref" is applied with its sibling keywords since 2019-09.
+type schemaPropertySub_ref struct {
+	location string
+	value    *schemaProperty
+}
+
+func newSubProp_ref(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["$ref"]
+	if !exist {
+		return nil, nil
+	}
+
+	path, ok := prop_raw.(string)
+	if !ok {
+		return nil, newSchemaError(m.KeywordLocation("$ref"), "$ref", prop_raw, ErrInvalidReference, "must be a string, but got %s", getJsonTypeOf(prop_raw))
+	}
+
+	value, err := m.schemaobject.refResolver.GetReferencedObject(path, m.KeywordLocation("$ref"), m)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(schemaPropertySub_ref)
+	s.location = m.KeywordLocation("$ref")
+	s.value = value
+
+	return s, nil
+}
+
+func (s *schemaPropertySub_ref) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	if !ctx.EnterRef(s.location, s.value, src, ptr) {
+		return false
+	}
+	valid := s.value.Validate(ctx, src, ptr)
+	ctx.LeaveRef()
+	return valid
+}
+
+// defined at 8.2.4.2 (@Core 2019-09)
+type schemaPropertySub_recursiveRef struct {
+	location string
+	resource *schemaResource
+}
+
+func newSubProp_recursiveRef(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["$recursiveRef"]
+	if !exist {
+		return nil, nil
+	}
+
+	if path, ok := prop_raw.(string); !ok || path != "#" {
+		// the only allowed value is "#".
+		return nil, newSchemaError(m.KeywordLocation("$recursiveRef"), "$recursiveRef", prop_raw, ErrInvalidSchemaFormat, "must be \"#\", but got %s", formatJsonValue(prop_raw))
+	}
+
+	s := new(schemaPropertySub_recursiveRef)
+	s.location = m.KeywordLocation("$recursiveRef")
+	s.resource = m.resource
+	return s, nil
+}
+
+func (s *schemaPropertySub_recursiveRef) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	target := s.resource.root
+	if s.resource.recursiveAnchor {
+		// the outermost schema resource which has "$recursiveAnchor": true.
+		for _, r := range ctx.dynamicScope {
+			if r.recursiveAnchor {
+				target = r.root
+				break
+			}
+		}
+	}
+
+	if !ctx.EnterRef(s.location, target, src, ptr) {
+		return false
+	}
+	valid := target.Validate(ctx, src, ptr)
+	ctx.LeaveRef()
+	return valid
+}
+
+// defined at 8.2.3.2 (@Core 2020-12)
+type schemaPropertySub_dynamicRef struct {
+	location string
+	value    *schemaProperty
+
+	// anchor is the name of "$dynamicAnchor" which the reference resolves to dynamically.
+	// It is empty if the reference behaves like "$ref".
+	anchor string
+}
+
+func newSubProp_dynamicRef(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["$dynamicRef"]
+	if !exist {
+		return nil, nil
+	}
+
+	path, ok := prop_raw.(string)
+	if !ok {
+		return nil, newSchemaError(m.KeywordLocation("$dynamicRef"), "$dynamicRef", prop_raw, ErrInvalidReference, "must be a string, but got %s", getJsonTypeOf(prop_raw))
+	}
+
+	value, err := m.schemaobject.refResolver.GetReferencedObject(path, m.KeywordLocation("$dynamicRef"), m)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(schemaPropertySub_dynamicRef)
+	s.location = m.KeywordLocation("$dynamicRef")
+	s.value = value
+
+	// the reference is dynamic only if the initial target has "$dynamicAnchor" of the fragment.
+	if _, fragment := splitFragment(path); fragment != "" && s.value.dynamicAnchor == fragment {
+		s.anchor = fragment
+	}
+	return s, nil
+}
+
+func (s *schemaPropertySub_dynamicRef) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	target := s.value
+	if s.anchor != "" {
+		// the outermost schema resource which has the "$dynamicAnchor".
+		for _, r := range ctx.dynamicScope {
+			if node, ok := r.dynamicAnchors[s.anchor]; ok {
+				target = node
+				break
+			}
+		}
+	}
+
+	if !ctx.EnterRef(s.location, target, src, ptr) {
+		return false
+	}
+	valid := target.Validate(ctx, src, ptr)
+	ctx.LeaveRef()
+	return valid
+}
+
+// defined at 11.2 (@Core 2020-12)
+type schemaPropertySub_unevaluatedItems struct {
+	location string
+	value    *schemaProperty
+}
+
+func newSubProp_unevaluatedItems(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["unevaluatedItems"]
+	if !exist {
+		return nil, nil
+	}
+
+	s := new(schemaPropertySub_unevaluatedItems)
+	s.location = m.KeywordLocation("unevaluatedItems")
+	s.value = m.NewChild("unevaluatedItems")
+	err := s.value.RecognizeSchema(prop_raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *schemaPropertySub_unevaluatedItems) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	val, ok := src.([]interface{})
+	if !ok {
+		return true
+	}
+
+	valid := true
+	for i, v := range val {
+		if ctx.IsItemAnnotated(i) {
+			continue
+		}
+
+		if s.value.isFalse {
+			ctx.AddError(ptr, s.location, "unevaluatedItems", "unevaluated item %d is not allowed", i)
+			valid = false
+		} else if !s.value.Validate(ctx, v, ptr+"/"+strconv.Itoa(i)) {
+			valid = false
+		}
+		ctx.AnnotateItem(i)
+
+		if !valid && !ctx.ShouldContinue() {
+			return false
+		}
+	}
+	return valid
+}
+
+// defined at 11.3 (@Core 2020-12)
+type schemaPropertySub_unevaluatedProperties struct {
+	location string
+	value    *schemaProperty
+}
+
+func newSubProp_unevaluatedProperties(schema map[string]interface{}, m *schemaProperty) (schemaPropertySub, error) {
+	prop_raw, exist := schema["unevaluatedProperties"]
+	if !exist {
+		return nil, nil
+	}
+
+	s := new(schemaPropertySub_unevaluatedProperties)
+	s.location = m.KeywordLocation("unevaluatedProperties")
+	s.value = m.NewChild("unevaluatedProperties")
+	err := s.value.RecognizeSchema(prop_raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *schemaPropertySub_unevaluatedProperties) Validate(ctx *evalContext, src interface{}, ptr string) bool {
+	obj, ok := src.(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	names := make([]string, 0, len(obj))
+	for k := range obj {
+		if !ctx.IsPropertyAnnotated(k) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	valid := true
+	for _, k := range names {
+		if s.value.isFalse {
+			ctx.AddError(ptr, s.location, "unevaluatedProperties", "unevaluated property %q is not allowed", k)
+			valid = false
+		} else if !s.value.Validate(ctx, obj[k], ptr+"/"+escapeJsonPointer(k)) {
+			valid = false
+		}
+		ctx.AnnotateProperty(k)
+
+		if !valid && !ctx.ShouldContinue() {
+			return false
+		}
+	}
+	return valid
 }
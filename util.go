@@ -1,7 +1,11 @@
 package jsonschema
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
+	"sort"
+	"strings"
 )
 
 func getInteger(val interface{}) (result int, canconv bool) {
@@ -37,3 +41,37 @@ func convInterfaceArrayToStringArray(val []interface{}) []string {
 
 	return ret
 }
+
+// sortedKeys returns the names of the object in order, so that they are evaluated in a stable order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	jsonPointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// escapeJsonPointer escapes a reference token of JSON pointer. (defined at RFC6901 section 3)
+func escapeJsonPointer(token string) string {
+	return jsonPointerEscaper.Replace(token)
+}
+
+// unescapeJsonPointer unescapes a reference token of JSON pointer. (defined at RFC6901 section 4)
+func unescapeJsonPointer(token string) string {
+	return jsonPointerUnescaper.Replace(token)
+}
+
+// formatJsonValue formats a decoded json value for messages.
+func formatJsonValue(v interface{}) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
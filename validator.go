@@ -1,52 +1,649 @@
 package jsonschema
 
 import (
+	"container/list"
+	"crypto/sha256"
 	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Validator validates JSON documents against a compiled schema.
+// It is safe for concurrent use by multiple goroutines.
 type Validator struct {
 	schema *schemaObject
+
+	exhaustive    bool
+	maxErrors     int
+	outputFormat  OutputFormat
+	regexpEngine  RegexpEngine
+	regexpTimeout time.Duration
+
+	formatAssertion     bool
+	formats             map[string]FormatChecker
+	unknownFormatPolicy UnknownFormatPolicy
+	keywords            map[string]KeywordCompiler
+
+	// dialect is the dialect of schemas which do not declare "$schema".
+	dialect           *dialect
+	defaultSchemaType SchemaType
+	metaSchemas       map[string][]byte
+
+	// loader loads the schemas referred by URIs out of the schema document.
+	loader    Loader
+	resources map[string][]byte
+
+	lenientReferences bool
+	schemaValidation  bool
+
+	// warnings holds problems of the schema found on compilation.
+	warnings []string
+	// optionErr is the first error of the options, which fails NewValidator.
+	optionErr error
+}
+
+// Option configures a Validator.
+type Option func(*Validator)
+
+// WithExhaustive makes the validator collect every failure instead of stopping at the first one.
+// At most maxErrors failures are collected, or all of them if maxErrors is 0.
+func WithExhaustive(maxErrors int) Option {
+	return func(v *Validator) {
+		v.exhaustive = true
+		v.maxErrors = maxErrors
+	}
+}
+
+// WithOutputFormat sets the format of the document returned by Output. (OutputFormat_Basic by default)
+// NewValidator fails with ErrInvalidOutputFormat if the format is unknown.
+func WithOutputFormat(format OutputFormat) Option {
+	return func(v *Validator) {
+		v.outputFormat = format
+	}
+}
+
+// WithRegexpEngine sets the engine of regular expressions in pattern and patternProperties. (RegexpEngine_ECMA262 by default)
+func WithRegexpEngine(engine RegexpEngine) Option {
+	return func(v *Validator) {
+		v.regexpEngine = engine
+	}
+}
+
+// WithRegexpTimeout sets the timeout of matching a regular expression in pattern and patternProperties. (DefaultRegexpTimeout by default)
+// A validation which exceeds the timeout fails with ErrRegexpTimeout, instead of a ValidationError. It is unlimited if 0.
+func WithRegexpTimeout(timeout time.Duration) Option {
+	return func(v *Validator) {
+		v.regexpTimeout = timeout
+	}
+}
+
+// WithFormatAssertion sets whether the format keyword is validated, or treated as an annotation only. (true by default)
+func WithFormatAssertion(assertion bool) Option {
+	return func(v *Validator) {
+		v.formatAssertion = assertion
+	}
+}
+
+// WithFormat registers the checker of the format to the validator only.
+// It takes precedence over the checkers registered by RegisterFormat.
+func WithFormat(name string, checker FormatChecker) Option {
+	return func(v *Validator) {
+		v.formats[name] = checker
+	}
+}
+
+// WithUnknownFormatPolicy sets what to do with formats which have no checker. (UnknownFormatPolicy_Ignore by default)
+func WithUnknownFormatPolicy(policy UnknownFormatPolicy) Option {
+	return func(v *Validator) {
+		v.unknownFormatPolicy = policy
+	}
+}
+
+// WithKeyword registers the compiler of the custom keyword to the validator only.
+// It takes precedence over the compilers registered by RegisterKeyword.
+func WithKeyword(name string, compiler KeywordCompiler) Option {
+	return func(v *Validator) {
+		v.keywords[name] = compiler
+	}
+}
+
+// WithDefaultDialect sets the dialect of schemas which do not declare "$schema". (SchemaType_Draft4 by default)
+// It may be the URI of a custom meta-schema.
+func WithDefaultDialect(schemaType SchemaType) Option {
+	return func(v *Validator) {
+		v.defaultSchemaType = schemaType
+	}
+}
+
+// WithMetaSchema registers the custom meta-schema of the URI to the validator only.
+// It takes precedence over the meta-schemas registered by RegisterMetaSchema.
+func WithMetaSchema(uri string, metaSchema []byte) Option {
+	return func(v *Validator) {
+		v.metaSchemas[normalizeSchemaURI(uri)] = metaSchema
+	}
+}
+
+// WithLoader sets the loader of schemas referred by URIs out of the schema document. (DefaultLoader by default)
+func WithLoader(loader Loader) Option {
+	return func(v *Validator) {
+		v.loader = loader
+	}
+}
+
+// WithResource registers the schema document of the absolute URI to the validator only.
+// It takes precedence over the documents registered by AddResource.
+// NewValidator fails with ErrInvalidResourceURI or ErrInvalidSchemaFormat like AddResource, if the URI or the document is invalid.
+func WithResource(uri string, schema []byte) Option {
+	return func(v *Validator) {
+		uri, err := checkResource(uri, schema)
+		if err != nil {
+			if v.optionErr == nil {
+				v.optionErr = err
+			}
+			return
+		}
+		v.resources[uri] = schema
+	}
+}
+
+// WithLenientReferences sets whether references which refer to nothing are compiled as empty schemas,
+// instead of failing NewValidator with ErrUnresolvedReference. (false by default)
+// They are reported by Warnings.
+func WithLenientReferences(lenient bool) Option {
+	return func(v *Validator) {
+		v.lenientReferences = lenient
+	}
+}
+
+// WithSchemaValidation sets whether the schema is validated against the meta-schema of its dialect before compilation. (true by default)
+// Schemas of draft3 are not validated.
+func WithSchemaValidation(validate bool) Option {
+	return func(v *Validator) {
+		v.schemaValidation = validate
+	}
+}
+
+func NewValidator(schema []byte, opts ...Option) (*Validator, error) {
+	var obj interface{}
+	err := json.Unmarshal(schema, &obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return newValidator(obj, opts...)
+}
+
+func newValidator(schema interface{}, opts ...Option) (*Validator, error) {
+	v, err := newValidatorOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.schemaValidation {
+		err = validateSchema(schema, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := newSchemaObject(schema, v)
+	if err != nil {
+		return nil, err
+	}
+
+	v.schema = s
+	return v, nil
 }
 
-func NewValidator(schema []byte) (*Validator, error) {
-	jsonmap := make(map[string]interface{})
-	err := json.Unmarshal(schema, &jsonmap)
+// newValidatorOptions returns a validator with the options, which has not compiled a schema yet.
+func newValidatorOptions(opts ...Option) (*Validator, error) {
+	v := &Validator{
+		outputFormat:  OutputFormat_Basic,
+		regexpEngine:  RegexpEngine_ECMA262,
+		regexpTimeout: DefaultRegexpTimeout,
+
+		formatAssertion: true,
+		formats:         make(map[string]FormatChecker),
+		keywords:        make(map[string]KeywordCompiler),
+
+		defaultSchemaType: SchemaType_Draft4,
+		metaSchemas:       make(map[string][]byte),
+
+		loader:    DefaultLoader,
+		resources: make(map[string][]byte),
+
+		schemaValidation: true,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	if v.optionErr != nil {
+		return nil, v.optionErr
+	}
+
+	switch v.outputFormat {
+	case OutputFormat_Flag, OutputFormat_Basic, OutputFormat_Detailed, OutputFormat_Verbose:
+	default:
+		return nil, ErrInvalidOutputFormat
+	}
+
+	d, err := findDialect(v.defaultSchemaType.String(), v)
 	if err != nil {
 		return nil, err
 	}
+	v.dialect = d
+	return v, nil
+}
+
+// ValidateSchema validates the schema against the meta-schema of its dialect.
+// It returns an *InvalidSchemaError with every violation as a *SchemaError if the schema is invalid.
+func ValidateSchema(schema []byte, opts ...Option) error {
+	var obj interface{}
+	err := json.Unmarshal(schema, &obj)
+	if err != nil {
+		return err
+	}
+
+	v, err := newValidatorOptions(opts...)
+	if err != nil {
+		return err
+	}
+
+	return validateSchema(obj, v)
+}
+
+func validateSchema(schema interface{}, v *Validator) error {
+	d, err := getDialect(schema, v)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]*SchemaError, 0)
+	err = validateResource(schema, "", d, v, &errs)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return &InvalidSchemaError{Errors: errs}
+	}
+	return nil
+}
+
+// embeddedResource represents an embedded schema resource which declares another dialect.
+type embeddedResource struct {
+	raw     interface{}
+	ptr     string
+	dialect *dialect
+}
+
+// validateResource validates the schema at ptr against the meta-schema of the dialect.
+// Embedded schema resources of other dialects are validated against their own meta-schemas.
+func validateResource(schema interface{}, ptr string, d *dialect, v *Validator, errs *[]*SchemaError) error {
+	meta, err := getMetaValidator(d)
+	if err != nil {
+		return err
+	}
+
+	embedded := make([]*embeddedResource, 0)
+	extracted := extractResources(schema, ptr, true, d, v, &embedded)
+
+	if meta != nil {
+		ctx := newEvalContext(true, 0)
+		record := ctx.Record()
+		if _, ok := meta.schema.Validate(ctx, extracted).(ValidationErrors); ok {
+			// the same violation may be found by several vocabularies of the meta-schema.
+			seen := make(map[[2]string]bool)
+			for _, u := range metaSchemaViolations(record) {
+				e := newMetaSchemaError(schema, ptr, d, v, u)
+				if key := [2]string{e.Pointer, e.Message}; !seen[key] {
+					seen[key] = true
+					*errs = append(*errs, e)
+				}
+			}
+		}
+	}
+
+	for _, r := range embedded {
+		err = validateResource(r.raw, r.ptr, r.dialect, v, errs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metaSchemaViolations returns the innermost failed units under the recorded unit of a validation against the meta-schema.
+// For a keyword whose subschemas all failed (e.g. anyOf), it descends into the one which reaches deepest in the schema
+// if it finds invalid keywords there, or reports the keyword itself. (e.g. "items" of draft-07, which may be a schema or an array)
+func metaSchemaViolations(u *OutputUnit) []*OutputUnit {
+	failed := make([][]*OutputUnit, 0)
+	for _, child := range u.children {
+		if !child.Valid {
+			failed = append(failed, metaSchemaViolations(child))
+		}
+	}
+
+	if u.Error == "" {
+		ret := make([]*OutputUnit, 0)
+		for _, violations := range failed {
+			ret = append(ret, violations...)
+		}
+		return ret
+	}
+
+	best, bestDepth, unique := -1, -1, false
+	for i, violations := range failed {
+		depth := 0
+		for _, w := range violations {
+			if n := strings.Count(w.InstanceLocation, "/"); n > depth {
+				depth = n
+			}
+		}
+		switch {
+		case depth > bestDepth:
+			best, bestDepth, unique = i, depth, true
+		case depth == bestDepth:
+			unique = false
+		}
+	}
+	if unique {
+		for _, w := range failed[best] {
+			if metaSchemaKeyword(w.KeywordLocation, w.InstanceLocation) != "" {
+				return failed[best]
+			}
+		}
+	}
+	return []*OutputUnit{u}
+}
+
+// newMetaSchemaError converts the violation of the schema at ptr against the meta-schema into a SchemaError.
+func newMetaSchemaError(schema interface{}, ptr string, d *dialect, v *Validator, u *OutputUnit) *SchemaError {
+	var value interface{}
+	if res, err := resolvePointer(&rawResource{raw: schema, dialect: d}, u.InstanceLocation, v); err == nil {
+		value = res.raw
+	}
 
-	return newValidator(jsonmap)
+	keyword := metaSchemaKeyword(u.KeywordLocation, u.InstanceLocation)
+	return &SchemaError{
+		Pointer: "#" + ptr + u.InstanceLocation,
+		Keyword: keyword,
+		Value:   value,
+		Message: u.Error,
+		err:     metaSchemaSentinel(keyword, value),
+	}
+}
+
+// metaSchemaKeyword returns the name of the invalid keyword from the locations of a violation against the meta-schema,
+// or "" if the invalid value is not a keyword. (e.g. a subschema of "properties")
+// The keyword is the last name which the meta-schema checks by "properties", unless it descends into a subschema after that.
+func metaSchemaKeyword(keywordLocation, instanceLocation string) string {
+	tokens := strings.Split(strings.TrimPrefix(keywordLocation, "#"), "/")[1:]
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	keyword := ""
+	// the last token is the failed keyword of the meta-schema.
+	for i := 0; i < len(tokens)-1; i++ {
+		switch tokens[i] {
+		case "properties":
+			i++
+			keyword = unescapeJsonPointer(tokens[i])
+		case "patternProperties":
+			i++
+			keyword = ""
+		case "additionalProperties", "items", "prefixItems", "additionalItems", "contains", "propertyNames", "unevaluatedProperties", "unevaluatedItems":
+			keyword = ""
+		}
+	}
+
+	instanceTokens := strings.Split(instanceLocation, "/")
+	if keyword == "" || unescapeJsonPointer(instanceTokens[len(instanceTokens)-1]) != keyword {
+		return ""
+	}
+	return keyword
+}
+
+// metaSchemaSentinel returns the sentinel error of the invalid keyword, which is the same as the one on compilation.
+func metaSchemaSentinel(keyword string, value interface{}) error {
+	switch keyword {
+	case "type":
+		names, ok := value.([]interface{})
+		if !ok {
+			names = []interface{}{value}
+		}
+		unknown := false
+		for _, name := range names {
+			str, ok := name.(string)
+			if !ok {
+				return ErrInvalidSchemaFormat
+			}
+			if _, err := GetJsonType(str); err != nil {
+				unknown = true
+			}
+		}
+		if unknown {
+			return ErrInvalidTypeName
+		}
+	case "$schema":
+		return ErrInvalidSchemaVersion
+	case "$ref", "$dynamicRef", "$recursiveRef":
+		return ErrInvalidReference
+	}
+	return ErrInvalidSchemaFormat
+}
+
+// extractResources returns a copy of raw, where the embedded schema resources of other dialects are replaced by empty schemas.
+func extractResources(raw interface{}, ptr string, root bool, d *dialect, v *Validator, embedded *[]*embeddedResource) interface{} {
+	switch obj := raw.(type) {
+	case map[string]interface{}:
+		if dd := resourceDialect(obj, d, v); dd != d && !root {
+			*embedded = append(*embedded, &embeddedResource{raw: obj, ptr: ptr, dialect: dd})
+			return map[string]interface{}{}
+		}
+
+		ret := make(map[string]interface{}, len(obj))
+		for _, k := range sortedKeys(obj) {
+			val := obj[k]
+			if k == "enum" || k == "const" {
+				// not schemas
+				ret[k] = val
+				continue
+			}
+			ret[k] = extractResources(val, ptr+"/"+escapeJsonPointer(k), false, d, v, embedded)
+		}
+		return ret
+
+	case []interface{}:
+		ret := make([]interface{}, len(obj))
+		for i, val := range obj {
+			ret[i] = extractResources(val, ptr+"/"+strconv.Itoa(i), false, d, v, embedded)
+		}
+		return ret
+	}
+
+	return raw
+}
+
+var metaValidators = struct {
+	sync.Mutex
+	validators map[*dialect]*Validator
+}{
+	validators: make(map[*dialect]*Validator),
 }
 
-func newValidator(schema map[string]interface{})(*Validator, error) {
-	s, err := newSchemaObject(schema)
+// getMetaValidator returns the validator of the embedded meta-schema of the dialect, or nil if not embedded.
+// Formats are not asserted, since the meta-schemas use them only as annotations.
+func getMetaValidator(d *dialect) (*Validator, error) {
+	metaValidators.Lock()
+	defer metaValidators.Unlock()
+
+	if v, ok := metaValidators.validators[d]; ok {
+		return v, nil
+	}
+
+	buf, ok := getEmbeddedMetaSchema(normalizeSchemaURI(d.schemaType.String()))
+	if !ok {
+		return nil, nil
+	}
+
+	v, err := NewValidator(buf, WithExhaustive(0), WithSchemaValidation(false), WithFormatAssertion(false))
 	if err != nil {
 		return nil, err
 	}
 
-	return &Validator{
-		schema: s,
-	}, nil
+	metaValidators.validators[d] = v
+	return v, nil
 }
 
-func (v *Validator) IsValid(src []byte)(bool, error) {
+// Warnings returns problems of the schema found on compilation. (e.g. unknown formats with UnknownFormatPolicy_Warn)
+func (v *Validator) Warnings() []string {
+	return v.warnings
+}
+
+// Validate validates src against the schema.
+// It returns a *ValidationError (or ValidationErrors with WithExhaustive) if src is invalid,
+// an error from encoding/json if src is not a JSON, or ErrRegexpTimeout or ErrInfiniteRecursion if the validation is stopped.
+func (v *Validator) Validate(src []byte) error {
+	var obj interface{}
+	err := json.Unmarshal(src, &obj)
+	if err != nil {
+		return err
+	}
+
+	return v.schema.Validate(newEvalContext(v.exhaustive, v.maxErrors), obj)
+}
+
+func (v *Validator) IsValid(src []byte) (bool, error) {
+	err := v.Validate(src)
+	switch err.(type) {
+	case nil:
+		return true, nil
+	case *ValidationError, ValidationErrors:
+		return false, nil
+	}
+
+	return false, err
+}
+
+// Output validates src against the schema, and returns the result as a JSON document in the format set by WithOutputFormat.
+// Every failure is reported regardless of WithExhaustive.
+// It returns an error only if src is not a JSON, or the validation is stopped. (e.g. ErrRegexpTimeout, ErrInfiniteRecursion)
+func (v *Validator) Output(src []byte) ([]byte, error) {
 	var obj interface{}
 	err := json.Unmarshal(src, &obj)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	ctx := newEvalContext(true, 0)
+	var record *OutputUnit
+	if v.outputFormat == OutputFormat_Detailed || v.outputFormat == OutputFormat_Verbose {
+		record = ctx.Record()
+	}
+	v.schema.Validate(ctx, obj)
+	if err := ctx.Aborted(); err != nil {
+		return nil, err
 	}
 
-	return v.schema.IsValid(obj), nil
+	return json.Marshal(newOutput(v.outputFormat, ctx, record))
 }
 
+// Unmarshal validates src against the schema, and decodes it into dst like json.Unmarshal only if src is valid.
+// It returns the error of Validate if src is invalid.
 func (v *Validator) Unmarshal(src []byte, dst interface{}) error {
-	return nil
+	err := v.Validate(src)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(src, dst)
 }
 
+// Marshal encodes src like json.Marshal, and returns the encoded document only if it is valid against the schema.
+// It returns the error of Validate if the document is invalid.
 func (v *Validator) Marshal(src interface{}) ([]byte, error) {
-	return nil, nil
+	buf, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+
+	err = v.Validate(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// maxCachedValidators limits the schemas in validatorCache, which drops the least recently used one first.
+const maxCachedValidators = 256
+
+// cachedValidator is a schema in validatorCache, which is compiled once by the first call.
+type cachedValidator struct {
+	key       [sha256.Size]byte
+	once      sync.Once
+	validator *Validator
+	err       error
+}
+
+var validatorCache = struct {
+	sync.Mutex
+	validators map[[sha256.Size]byte]*list.Element
+	// recent holds the cached schemas from the most recently used one.
+	recent *list.List
+}{
+	validators: make(map[[sha256.Size]byte]*list.Element),
+	recent:     list.New(),
+}
+
+// getCachedValidator returns the cached schema of the key, which is added if not cached.
+func getCachedValidator(key [sha256.Size]byte) *cachedValidator {
+	validatorCache.Lock()
+	defer validatorCache.Unlock()
+
+	if e, ok := validatorCache.validators[key]; ok {
+		validatorCache.recent.MoveToFront(e)
+		return e.Value.(*cachedValidator)
+	}
+
+	c := &cachedValidator{key: key}
+	validatorCache.validators[key] = validatorCache.recent.PushFront(c)
+	if validatorCache.recent.Len() > maxCachedValidators {
+		removeCachedValidator(validatorCache.recent.Back().Value.(*cachedValidator))
+	}
+	return c
+}
+
+// removeCachedValidator drops the cached schema, unless it has been replaced. validatorCache must be locked.
+func removeCachedValidator(c *cachedValidator) {
+	if e, ok := validatorCache.validators[c.key]; ok && e.Value == c {
+		validatorCache.recent.Remove(e)
+		delete(validatorCache.validators, c.key)
+	}
 }
 
-func IsValid() bool {
-	return false
+// Validate validates document against schema with the default options.
+// Compiled schemas are cached by their content and reused by following calls, up to the recently used ones.
+// A cached schema is a snapshot: formats and keywords registered after its compilation are not applied to it.
+func Validate(schema, document []byte) error {
+	c := getCachedValidator(sha256.Sum256(schema))
+
+	// compiled out of the lock, so that loading references never blocks the other schemas.
+	c.once.Do(func() {
+		c.validator, c.err = NewValidator(schema)
+	})
+
+	if c.err != nil {
+		// failures are not cached, as the loader may succeed on the next call.
+		validatorCache.Lock()
+		removeCachedValidator(c)
+		validatorCache.Unlock()
+		return c.err
+	}
+
+	return c.validator.Validate(document)
 }